@@ -1,10 +1,10 @@
 package spiral
 
 type Balance struct {
-	Currency  string  `json:"currency"`
-	Available float64 `json:"available,string"`
-	Locked    float64 `json:"locked,string"`
-	Timestamp int64   `json:"timestamp"`
+	Currency  string    `json:"currency"`
+	Available float64   `json:"available,string"`
+	Locked    float64   `json:"locked,string"`
+	Timestamp Timestamp `json:"timestamp"`
 }
 
 type BalanceReturn struct {
@@ -1,6 +1,7 @@
 package spiral
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -16,6 +17,19 @@ import (
 	"time"
 )
 
+// ErrTimeout is returned when the API does not answer within the timeout of the client.
+var ErrTimeout = errors.New("timeout on reading data from Spiral API")
+
+// StatusError is returned when the API answers with an unexpected HTTP status.
+type StatusError struct {
+	Code   int
+	Status string // ie. 502 Bad Gateway
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
 type client struct {
 	apiKey      string
 	apiSecret   string
@@ -69,36 +83,26 @@ func (c client) dumpResponse(r *http.Response) {
 	}
 }
 
-// doTimeoutRequest do a HTTP request with timeout
-func (c *client) doTimeoutRequest(timer *time.Timer, req *http.Request) (*http.Response, error) {
-	// Do the request in the background so we can check the timeout
-	type result struct {
-		resp *http.Response
-		err  error
-	}
-	done := make(chan result, 1)
-	go func() {
-		if c.debug {
-			c.dumpRequest(req)
-		}
-		resp, err := c.httpClient.Do(req)
-		if c.debug {
-			c.dumpResponse(resp)
-		}
-		done <- result{resp, err}
-	}()
-	// Wait for the read or the timeout
-	select {
-	case r := <-done:
-		return r.resp, r.err
-	case <-timer.C:
-		return nil, errors.New("timeout on reading data from Spiral API")
+// doTimeoutRequest do a HTTP request cancelled once ctx is done. It only
+// returns once the request ended, so nothing is sent after a timeout.
+func (c *client) doTimeoutRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.debug {
+		c.dumpRequest(req)
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if c.debug {
+		c.dumpResponse(resp)
 	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, ErrTimeout
+	}
+	return resp, err
 }
 
 // do prepare and process HTTP request to Spiral API
 func (c *client) do(method string, resource string, params map[string]string, authNeeded bool) (response []byte, err error) {
-	connectTimer := time.NewTimer(c.httpTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), c.httpTimeout)
+	defer cancel()
 
 	var rawurl string
 	if strings.HasPrefix(resource, "http") {
@@ -154,7 +158,7 @@ func (c *client) do(method string, resource string, params map[string]string, au
 		}
 	}
 
-	resp, err := c.doTimeoutRequest(connectTimer, req)
+	resp, err := c.doTimeoutRequest(ctx, req)
 	if err != nil {
 		return
 	}
@@ -162,10 +166,13 @@ func (c *client) do(method string, resource string, params map[string]string, au
 	defer resp.Body.Close()
 	response, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ErrTimeout
+		}
 		return response, err
 	}
 	if resp.StatusCode != 200 && resp.StatusCode != 401 {
-		return response, errors.New(resp.Status)
+		return response, &StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 	return response, err
 }
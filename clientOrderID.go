@@ -0,0 +1,144 @@
+package spiral
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// OrderIDGenerator generates client order ids made of a prefix, a strategy
+// tag, a random session id and a monotonic counter, ie. bot-grid-3f9c2a1b-1a.
+//
+// The session id is drawn once per generator, so ids never repeat within a
+// generator and collide across generators with negligible probability.
+type OrderIDGenerator struct {
+	counter  uint64 // accessed atomically, kept first for alignment
+	prefix   string
+	strategy string
+	session  string
+}
+
+// NewOrderIDGenerator returns a generator of ids starting with prefix and
+// strategy, either of which may be empty.
+func NewOrderIDGenerator(prefix, strategy string) (*OrderIDGenerator, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	return &OrderIDGenerator{prefix: prefix, strategy: strategy, session: id[:8]}, nil
+}
+
+// Next returns a new client order id.
+func (g *OrderIDGenerator) Next() string {
+	n := atomic.AddUint64(&g.counter, 1)
+	parts := make([]string, 0, 4)
+	for _, p := range []string{g.prefix, g.strategy, g.session, strconv.FormatUint(n, 36)} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// SetOrderIDGenerator makes PlaceOrder fill the empty client order ids with
+// the ids of g. A nil g sends them empty again.
+func (b *Spiral) SetOrderIDGenerator(g *OrderIDGenerator) {
+	b.orderIDs = g
+}
+
+// OrderUncertainError is returned by PlaceOrderIdempotent when placing an
+// order failed in a way that may have placed it, and looking it up failed as
+// well. Look the order up with GetOrderByClientID once the API is reachable before
+// placing it again.
+type OrderUncertainError struct {
+	ClientOrderId string
+	Err           error // error of the placement
+	LookupErr     error // error of the lookup
+}
+
+func (e *OrderUncertainError) Error() string {
+	return fmt.Sprintf("spiral: order %s may have been placed: %v, lookup failed: %v", e.ClientOrderId, e.Err, e.LookupErr)
+}
+
+// PlaceOrderIdempotent places requestOrder at most once, making up to
+// attempts tries, at least one.
+//
+// The order gets a client order id from the generator set by
+// SetOrderIDGenerator when it has none. When a try times out or the
+// connection fails the order may have reached the API, so once the request
+// is cancelled the order is looked up by its client order id with
+// GetOrderByClientID: an order found is returned as placed and the order is
+// only sent again when it was not found. An OrderUncertainError is returned
+// when the lookup fails too.
+func (b *Spiral) PlaceOrderIdempotent(requestOrder Orders, attempts int) (resp PlaceReturn, err error) {
+	if attempts <= 0 {
+		err = fmt.Errorf("spiral: idempotent orders need at least one attempt, got %d", attempts)
+		return
+	}
+	if requestOrder.ClientOrderId == "" {
+		if b.orderIDs == nil {
+			err = fmt.Errorf("spiral: idempotent orders need a client order id or an OrderIDGenerator")
+			return
+		}
+		requestOrder.ClientOrderId = b.orderIDs.Next()
+	}
+
+	for i := 0; i < attempts; i++ {
+		resp, err = b.PlaceOrder(requestOrder)
+		if err == nil || !isTransient(err) {
+			return
+		}
+
+		placed, found, lookupErr := b.lookupOrder(requestOrder.ClientOrderId)
+		if lookupErr != nil {
+			err = &OrderUncertainError{ClientOrderId: requestOrder.ClientOrderId, Err: err, LookupErr: lookupErr}
+			return
+		}
+		if found {
+			return placeReturn(placed), nil
+		}
+	}
+	return
+}
+
+// lookupOrder returns the order clientOrderId, found being false when the API
+// does not know it.
+func (b *Spiral) lookupOrder(clientOrderId string) (order Orders, found bool, err error) {
+	order, err = b.GetOrderByClientID(clientOrderId)
+	var notFound *OrderNotFoundError
+	if errors.As(err, &notFound) {
+		return Orders{}, false, nil
+	}
+	return order, err == nil, err
+}
+
+// placeReturn returns order as PlaceOrder returns it.
+func placeReturn(order Orders) PlaceReturn {
+	return PlaceReturn{Order: PlaceData{
+		Id:            order.Id,
+		ClientOrderId: order.ClientOrderId,
+		Symbol:        order.Symbol,
+		Side:          order.Side,
+		Price:         order.Price,
+		Quantity:      order.Quantity,
+		Type:          order.Type,
+		Status:        order.Status,
+		CreateTime:    order.CreateTime,
+		UpdateTime:    order.UpdateTime,
+	}}
+}
+
+// isTransient reports whether err, or an error it wraps, leaves unknown
+// whether the request reached the API: timeouts, connection failures and
+// server errors.
+func isTransient(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code >= 500
+	}
+	var netErr net.Error // including *url.Error
+	return errors.As(err, &netErr) || errors.Is(err, ErrTimeout)
+}
@@ -0,0 +1,175 @@
+package spiral
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inFlight counts the requests sent by a client which did not return yet.
+type inFlight struct {
+	rewriteHost
+	posts int32 // accessed atomically
+}
+
+func (f *inFlight) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "POST" {
+		atomic.AddInt32(&f.posts, 1)
+		defer atomic.AddInt32(&f.posts, -1)
+	}
+	return f.rewriteHost.RoundTrip(req)
+}
+
+// orderServer leaves the first hang POST requests unanswered until they are
+// cancelled and answers the next ones with the order. GET requests answer the order once
+// placed, or found is set, and count the POST requests in flight at the time.
+type orderServer struct {
+	*httptest.Server
+	transport *inFlight
+
+	mu       sync.Mutex
+	hang     int
+	found    bool
+	posts    int
+	inFlight []int32 // POST requests in flight at each lookup
+}
+
+const placedOrder = `{"id":42,"clt_ord_id":"idem-1","symbol":"ETHBTC","side":"bid","type":"limit","status":"accepted"}`
+
+func newOrderServer(t *testing.T, hang int, found bool) (*orderServer, *Spiral) {
+	s := &orderServer{hang: hang, found: found}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		if r.Method == "GET" {
+			s.inFlight = append(s.inFlight, atomic.LoadInt32(&s.transport.posts))
+			found := s.found
+			s.mu.Unlock()
+			if found {
+				w.Write([]byte(`{"orders":[` + placedOrder + `]}`))
+			} else {
+				w.Write([]byte(`{"orders":[]}`))
+			}
+			return
+		}
+
+		s.posts++
+		hang := s.posts <= s.hang
+		s.mu.Unlock()
+		if hang {
+			ioutil.ReadAll(r.Body) // lets the server notice the cancellation
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"order":` + placedOrder + `}`))
+	}))
+	t.Cleanup(s.Close)
+	base, _ := url.Parse(s.URL)
+	s.transport = &inFlight{rewriteHost: rewriteHost{base}}
+	api := NewWithCustomHttpClient("key", "secret", &http.Client{Transport: s.transport, Timeout: 100 * time.Millisecond})
+	return s, api
+}
+
+func (s *orderServer) stats() (posts int, inFlight []int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posts, append([]int32(nil), s.inFlight...)
+}
+
+var idempotentOrder = Orders{ClientOrderId: "idem-1", Symbol: "ETHBTC", Side: BidSide, Type: LimitOrderType, Price: 0.05, Quantity: 1}
+
+// A timed out try is cancelled before the order is looked up, and sent again
+// when it was not found.
+func TestPlaceOrderIdempotentResends(t *testing.T) {
+	server, api := newOrderServer(t, 1, false)
+
+	resp, err := api.PlaceOrderIdempotent(idempotentOrder, 2)
+	if err != nil || resp.Order.Id != 42 {
+		t.Fatalf("PlaceOrderIdempotent = %+v, %v", resp, err)
+	}
+	posts, inFlight := server.stats()
+	if posts != 2 || len(inFlight) != 1 || inFlight[0] != 0 {
+		t.Errorf("%d orders sent, %v in flight at the lookups, want 2 and [0]", posts, inFlight)
+	}
+}
+
+// An order found by the lookup is not sent again.
+func TestPlaceOrderIdempotentFound(t *testing.T) {
+	server, api := newOrderServer(t, 1, true)
+
+	resp, err := api.PlaceOrderIdempotent(idempotentOrder, 3)
+	if err != nil || resp.Order.Id != 42 || resp.Order.ClientOrderId != "idem-1" {
+		t.Fatalf("PlaceOrderIdempotent = %+v, %v", resp, err)
+	}
+	if posts, inFlight := server.stats(); posts != 1 || len(inFlight) != 1 || inFlight[0] != 0 {
+		t.Errorf("%d orders sent, %v in flight at the lookups, want 1 and [0]", posts, inFlight)
+	}
+}
+
+func TestPlaceOrderIdempotentAttempts(t *testing.T) {
+	server, api := newOrderServer(t, 0, false)
+
+	for _, attempts := range []int{0, -1} {
+		if _, err := api.PlaceOrderIdempotent(idempotentOrder, attempts); err == nil {
+			t.Errorf("PlaceOrderIdempotent with %d attempts succeeded", attempts)
+		}
+	}
+	if posts, _ := server.stats(); posts != 0 {
+		t.Errorf("%d orders sent without attempts", posts)
+	}
+}
+
+// Every try timing out and the order never being found leaves the last
+// timeout, and the lookup errors are reported as OrderUncertainError.
+func TestPlaceOrderIdempotentGivesUp(t *testing.T) {
+	server, api := newOrderServer(t, 2, false)
+
+	_, err := api.PlaceOrderIdempotent(idempotentOrder, 2)
+	if !isTransient(err) {
+		t.Errorf("PlaceOrderIdempotent = %v, want a timeout", err)
+	}
+	if posts, inFlight := server.stats(); posts != 2 || len(inFlight) != 2 {
+		t.Errorf("%d orders sent and %d lookups, want 2 and 2", posts, len(inFlight))
+	}
+
+	server.Close()
+	_, err = api.PlaceOrderIdempotent(idempotentOrder, 1)
+	var uncertain *OrderUncertainError
+	if !errors.As(err, &uncertain) || uncertain.ClientOrderId != "idem-1" {
+		t.Errorf("PlaceOrderIdempotent without server = %v", err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "https://api.spiral.exchange/api/v1/order", Err: errors.New("connection refused")}
+	for _, c := range []struct {
+		err       error
+		transient bool
+	}{
+		{ErrTimeout, true},
+		{fmt.Errorf("placing order: %w", ErrTimeout), true},
+		{refused, true},
+		{fmt.Errorf("placing order: %w", refused), true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&StatusError{Code: http.StatusBadGateway}, true},
+		{fmt.Errorf("placing order: %w", &StatusError{Code: http.StatusServiceUnavailable}), true},
+		{&StatusError{Code: http.StatusBadRequest}, false},
+		{fmt.Errorf("placing order: %w", &StatusError{Code: http.StatusUnauthorized}), false},
+		{errors.New("insufficient balance"), false},
+		{nil, false},
+	} {
+		if transient := isTransient(c.err); transient != c.transient {
+			t.Errorf("isTransient(%v) = %v, want %v", c.err, transient, c.transient)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package spiral
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is a number sent by the API, usually as a string to keep its
+// precision.
+//
+// The value sent is kept verbatim: String returns it, Rat converts it exactly
+// and Float64 approximates it like the float64 fields of the REST models.
+type Decimal struct {
+	raw   string
+	value float64
+}
+
+// ParseDecimal parses a decimal number, the empty string being zero.
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("spiral: cannot parse decimal %q", s)
+	}
+	return Decimal{raw: s, value: f}, nil
+}
+
+// NewDecimal returns the decimal of f, formatted with the fewest digits
+// representing it.
+func NewDecimal(f float64) Decimal {
+	return Decimal{raw: strconv.FormatFloat(f, 'f', -1, 64), value: f}
+}
+
+// String returns the number as sent by the API, empty when it was absent.
+func (d Decimal) String() string {
+	return d.raw
+}
+
+// Float64 returns the nearest float64 of the number.
+func (d Decimal) Float64() float64 {
+	return d.value
+}
+
+// Rat returns the exact value of the number.
+func (d Decimal) Rat() *big.Rat {
+	r := new(big.Rat)
+	if d.raw != "" {
+		r.SetString(d.raw)
+	}
+	return r
+}
+
+// IsZero reports whether the number is zero or absent.
+func (d Decimal) IsZero() bool {
+	return d.value == 0
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Numbers are accepted as JSON
+// strings or numbers.
+func (d *Decimal) UnmarshalJSON(bs []byte) error {
+	bs = bytes.TrimSpace(bs)
+	if bytes.Equal(bs, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+
+	s := string(bs)
+	if len(bs) > 0 && bs[0] == '"' {
+		if err := json.Unmarshal(bs, &s); err != nil {
+			return err
+		}
+	}
+	dec, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = dec
+	return nil
+}
+
+// MarshalJSON encodes the number as the string sent by the API.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d.raw == "" {
+		return []byte(`"0"`), nil
+	}
+	return json.Marshal(d.raw)
+}
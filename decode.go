@@ -0,0 +1,115 @@
+package spiral
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// arrayDecoder reads the positional fields of array encoded payloads such as
+// klines and order book rows, accepting both string and number encodings.
+type arrayDecoder struct {
+	typ string
+	arr []interface{}
+	err error
+}
+
+// newArrayDecoder decodes bs as a JSON array holding at least size elements.
+func newArrayDecoder(typ string, bs []byte, size int) *arrayDecoder {
+	d := &arrayDecoder{typ: typ}
+
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	if err := dec.Decode(&d.arr); err != nil {
+		d.err = &DecodeError{Type: typ, Err: err}
+		return d
+	}
+	if len(d.arr) < size {
+		d.err = &DecodeError{Type: typ, Err: fmt.Errorf("expected %d elements, got %d", size, len(d.arr))}
+	}
+	return d
+}
+
+func (d *arrayDecoder) fail(i int, field string, err error) {
+	if d.err == nil {
+		d.err = &DecodeError{Type: d.typ, Field: field, Index: i, Err: err}
+	}
+}
+
+// raw returns the textual form of element i.
+func (d *arrayDecoder) raw(i int, field string) (string, bool) {
+	if d.err != nil {
+		return "", false
+	}
+	switch v := d.arr[i].(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	default:
+		d.fail(i, field, fmt.Errorf("expected string or number, got %T", v))
+		return "", false
+	}
+}
+
+func (d *arrayDecoder) float(i int, field string) float64 {
+	s, ok := d.raw(i, field)
+	if !ok {
+		return 0
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		d.fail(i, field, err)
+		return 0
+	}
+	// ParseFloat accepts "NaN" and "Inf", which no price or amount can be
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		d.fail(i, field, fmt.Errorf("%q is not a finite number", s))
+		return 0
+	}
+	return f
+}
+
+func (d *arrayDecoder) int(i int, field string) int64 {
+	s, ok := d.raw(i, field)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		// tolerate integral values sent as 1.5e+12 or "12.0"
+		f, ferr := strconv.ParseFloat(s, 64)
+		// float64(math.MaxInt64) rounds up to 2^63, which does not fit
+		if ferr != nil || f != math.Trunc(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+			d.fail(i, field, err)
+			return 0
+		}
+		n = int64(f)
+	}
+	return n
+}
+
+func (d *arrayDecoder) time(i int, field string) Timestamp {
+	s, ok := d.raw(i, field)
+	if !ok {
+		return Timestamp{}
+	}
+	t, err := parseTimestamp(s)
+	if err != nil {
+		d.fail(i, field, err)
+	}
+	return t
+}
+
+func (d *arrayDecoder) string(i int, field string) string {
+	if d.err != nil {
+		return ""
+	}
+	if d.arr[i] == nil {
+		return ""
+	}
+	s, _ := d.raw(i, field)
+	return s
+}
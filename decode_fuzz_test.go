@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+package spiral
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// checkDecoded fails when a valid JSON payload is rejected with another
+// error than a DecodeError. Invalid JSON is rejected by encoding/json.
+func checkDecoded(t *testing.T, data []byte, err error) {
+	if err == nil || !json.Valid(data) {
+		return
+	}
+	if _, ok := err.(*DecodeError); !ok {
+		t.Errorf("Unmarshal(%q) error = %#v, want a DecodeError", data, err)
+	}
+}
+
+func FuzzKLineUnmarshal(f *testing.F) {
+	f.Add([]byte(`[1546300800000, "3700.5", 3800, "3600", "3750.25", "12.5", 1546300859999, null, "42"]`))
+	f.Add([]byte(`["1546300800", 1, 2, 3, 4, 5, "1546300859", "", 9.2233720368547758e18]`))
+	f.Add([]byte(`[1, 2, 3]`))
+	f.Add([]byte(`{"open": 1}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var k KLine
+		checkDecoded(t, data, json.Unmarshal(data, &k))
+	})
+}
+
+func FuzzOrderbookDataUnmarshal(f *testing.F) {
+	f.Add([]byte(`["3700.5", "1.25", "bid"]`))
+	f.Add([]byte(`[3701, 2, "ask", "extra"]`))
+	f.Add([]byte(`[null, null, null]`))
+	f.Add([]byte(`["1e400", "-0", 1]`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var row OrderbookData
+		checkDecoded(t, data, json.Unmarshal(data, &row))
+	})
+}
+
+func FuzzKLineReturnUnmarshal(f *testing.F) {
+	f.Add([]byte(`{"data": [[1546300800000, "1", "2", "0.5", "1.5", "10", 1546300859999, null, 3]]}`))
+	f.Add([]byte(`{"error_code": 1, "message": "bad symbol"}`))
+	f.Add([]byte(`{"data": [[1], []]}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r KLineReturn
+		json.Unmarshal(data, &r)
+	})
+}
+
+func FuzzOrderbookReturnUnmarshal(f *testing.F) {
+	f.Add([]byte(`{"symbol": "BTCUSDT", "last_update_id": 7, "data": [["3700.5", "1.25", "bid"], [3701, 2, "ask"]]}`))
+	f.Add([]byte(`{"data": [["1"], "x"]}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r OrderbookReturn
+		json.Unmarshal(data, &r)
+	})
+}
+
+func FuzzTimestampUnmarshal(f *testing.F) {
+	f.Add([]byte(`1546300800`))
+	f.Add([]byte(`"1546300800123"`))
+	f.Add([]byte(`99999999999999`))
+	f.Add([]byte(`-9223372036854775808`))
+	f.Add([]byte(`"2019-01-01T00:00:00.5Z"`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var ts Timestamp
+		if json.Unmarshal(data, &ts) != nil || ts.Year() < 0 || ts.Year() > 9999 {
+			return
+		}
+		// RFC3339 only represents years 0 to 9999
+		bs, err := json.Marshal(ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Timestamp
+		if err = json.Unmarshal(bs, &back); err != nil || !back.Equal(ts.Time) {
+			t.Errorf("%s decoded as %v, which round trips as %s to %v (%v)", data, ts, bs, back, err)
+		}
+	})
+}
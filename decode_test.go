@@ -0,0 +1,113 @@
+package spiral
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestArrayDecoderInt(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{`[12]`, 12, true},
+		{`["12"]`, 12, true},
+		{`[1.5e+12]`, 1500000000000, true},
+		{`["12.0"]`, 12, true},
+		{`[-9223372036854775808]`, math.MinInt64, true},
+		{`[9223372036854775807]`, math.MaxInt64, true},
+		{`[-9.223372036854775808e18]`, math.MinInt64, true},
+		{`[9.223372036854775808e18]`, 0, false}, // 2^63
+		{`[1e19]`, 0, false},
+		{`[-1e19]`, 0, false},
+		{`[1.5]`, 0, false},
+		{`["abc"]`, 0, false},
+		{`[null]`, 0, false},
+		{`["NaN"]`, 0, false},
+		{`["Inf"]`, 0, false},
+		{`["+Inf"]`, 0, false},
+		{`["-Inf"]`, 0, false},
+	}
+	for _, tt := range tests {
+		d := newArrayDecoder("test", []byte(tt.in), 1)
+		got := d.int(0, "n")
+		if ok := d.err == nil; ok != tt.ok || got != tt.want {
+			t.Errorf("int(%s) = %d, %v, want %d, ok %v", tt.in, got, d.err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestArrayDecoderFloat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{`[12.5]`, 12.5, true},
+		{`["12.5"]`, 12.5, true},
+		{`["-0.001"]`, -0.001, true},
+		{`[1.5e-8]`, 1.5e-8, true},
+		{`["abc"]`, 0, false},
+		{`[null]`, 0, false},
+		{`["NaN"]`, 0, false},
+		{`["nan"]`, 0, false},
+		{`["Inf"]`, 0, false},
+		{`["+Inf"]`, 0, false},
+		{`["-Inf"]`, 0, false},
+		{`["Infinity"]`, 0, false},
+		{`[1e999]`, 0, false},
+	}
+	for _, tt := range tests {
+		d := newArrayDecoder("test", []byte(tt.in), 1)
+		got := d.float(0, "f")
+		if ok := d.err == nil; ok != tt.ok || got != tt.want {
+			t.Errorf("float(%s) = %v, %v, want %v, ok %v", tt.in, got, d.err, tt.want, tt.ok)
+		}
+		if _, ok := d.err.(*DecodeError); !tt.ok && !ok {
+			t.Errorf("float(%s) error = %v, want a DecodeError", tt.in, d.err)
+		}
+	}
+}
+
+func TestKLineUnmarshal(t *testing.T) {
+	var k KLine
+	in := `[1546300800000, "3700.5", 3800, "3600", "3750.25", "12.5", 1546300859999, null, "42"]`
+	if err := json.Unmarshal([]byte(in), &k); err != nil {
+		t.Fatal(err)
+	}
+	if k.OpenTs.Unix() != 1546300800 || k.Open != 3700.5 || k.High != 3800 || k.Close != 3750.25 ||
+		k.Vol != 12.5 || k.CloseTs.Unix() != 1546300859 || k.NumberOfTrade != 42 {
+		t.Errorf("kline = %+v", k)
+	}
+
+	for _, in := range []string{`[]`, `[1, 2, 3]`, `{"open": 1}`, `null`, `[1, "x", 3, 4, 5, 6, 7, 8, 9]`, `[1, 2, 3, 4, 5, 6, 7, 8, [9]]`, `[1, "NaN", 3, 4, 5, 6, 7, 8, 9]`, `[1, 2, "+Inf", 4, 5, 6, 7, 8, 9]`} {
+		k := KLine{Open: 1}
+		err := json.Unmarshal([]byte(in), &k)
+		if _, ok := err.(*DecodeError); !ok {
+			t.Errorf("Unmarshal(%s) error = %v, want a DecodeError", in, err)
+		}
+		if k.Open != 1 {
+			t.Errorf("Unmarshal(%s) changed the kline to %+v", in, k)
+		}
+	}
+}
+
+func TestOrderbookDataUnmarshal(t *testing.T) {
+	var rows []OrderbookData
+	if err := json.Unmarshal([]byte(`[["3700.5", "1.25", "bid"], [3701, 2, "ask"]]`), &rows); err != nil {
+		t.Fatal(err)
+	}
+	want := []OrderbookData{{3700.5, 1.25, BidSide}, {3701, 2, AskSide}}
+	if len(rows) != 2 || rows[0] != want[0] || rows[1] != want[1] {
+		t.Errorf("rows = %+v", rows)
+	}
+
+	for _, in := range []string{`[]`, `["1", "2"]`, `"1,2,bid"`, `[true, "2", "bid"]`, `["NaN", "2", "bid"]`, `["1", "Inf", "ask"]`} {
+		var row OrderbookData
+		if _, ok := json.Unmarshal([]byte(in), &row).(*DecodeError); !ok {
+			t.Errorf("Unmarshal(%s) did not return a DecodeError", in)
+		}
+	}
+}
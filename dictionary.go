@@ -4,7 +4,9 @@ type side string
 type orderType string
 type orderStatus string
 type currency string
-type period string
+
+// Period is the period of klines, a number of minutes.
+type Period string
 
 const (
 	BidSide side = "bid"
@@ -33,8 +35,17 @@ const (
 	LTC  currency = "LTC"
 	BCH  currency = "BCH"
 
-	Period1Minute   period = "1"
-	Period5Minutes  period = "5"
-	Period15Minutes period = "15"
-	Period1Hour     period = "60"
+	Period1Minute   Period = "1"
+	Period3Minutes  Period = "3"
+	Period5Minutes  Period = "5"
+	Period15Minutes Period = "15"
+	Period30Minutes Period = "30"
+	Period1Hour     Period = "60"
+	Period2Hours    Period = "120"
+	Period4Hours    Period = "240"
+	Period6Hours    Period = "360"
+	Period12Hours   Period = "720"
+	Period1Day      Period = "1440"
+	Period1Week     Period = "10080"
+	Period1Month    Period = "43200"
 )
@@ -1,6 +1,49 @@
 package spiral
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// orderNotFoundCode is the error code of an unknown order id or client order id.
+const orderNotFoundCode = 20002
+
 type errorResponse struct {
 	ErrorCode int64  `json:"error_code"`
 	Message   string `json:"message"`
 }
+
+// isOrderNotFound reports whether the response body r is the error of an
+// unknown order, whatever the HTTP status it was sent with.
+func isOrderNotFound(r []byte) bool {
+	var response errorResponse
+	return json.Unmarshal(r, &response) == nil && response.ErrorCode == orderNotFoundCode
+}
+
+// DecodeError is returned when an API payload does not have the expected shape.
+type DecodeError struct {
+	Type  string // decoded type, ie. KLine
+	Field string // field being decoded, empty when the whole value is rejected
+	Index int    // position of the field in array encoded payloads
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("spiral: cannot decode %s: %v", e.Type, e.Err)
+	}
+	return fmt.Sprintf("spiral: cannot decode %s.%s (index %d): %v", e.Type, e.Field, e.Index, e.Err)
+}
+
+// OrderNotFoundError is returned when the order looked up does not exist.
+type OrderNotFoundError struct {
+	Id            int64  // exchange id, 0 when looked up by client order id
+	ClientOrderId string // client order id, empty when looked up by exchange id
+}
+
+func (e *OrderNotFoundError) Error() string {
+	if e.ClientOrderId != "" {
+		return fmt.Sprintf("spiral: order with client order id %s not found", e.ClientOrderId)
+	}
+	return fmt.Sprintf("spiral: order %d not found", e.Id)
+}
@@ -0,0 +1,37 @@
+package spiral
+
+// MarketData is the public market data of an exchange.
+type MarketData interface {
+	GetCurrencies() ([]Currency, error)
+	GetSymbols() ([]Symbol, error)
+	GetKLines(market string, p Period, limit int) ([]KLine, error)
+	GetOrderbook(market string, limit int) (Orderbook, error)
+}
+
+// Account is the balances and trade history of an exchange account.
+type Account interface {
+	GetBalances() ([]Balance, error)
+	GetBalance(currency string) (Balance, error)
+	GetTrades(symbol string, count int) ([]Trade, error)
+}
+
+// Trading places and manages the orders of an exchange account. CancelOrder
+// takes the id the exchange gave to the order, as returned in Orders.Id, and
+// CancelOrderByClientID its client order id.
+type Trading interface {
+	PlaceOrder(requestOrder Orders) (PlaceReturn, error)
+	CancelOrder(orderId string) error
+	CancelOrderByClientID(clientOrderId string) error
+	GetOrderByClientID(clientOrderId string) (Orders, error)
+	GetOpenOrders(count int) ([]Orders, error)
+}
+
+// Exchange is implemented by Spiral and by the clients of other exchanges,
+// such as the hitbtc package, so the same code can trade on either.
+type Exchange interface {
+	MarketData
+	Account
+	Trading
+}
+
+var _ Exchange = (*Spiral)(nil)
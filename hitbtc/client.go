@@ -0,0 +1,92 @@
+package hitbtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type client struct {
+	apiKey     string
+	apiSecret  string
+	httpClient *http.Client
+}
+
+// errorResponse is the body of a failed request.
+type errorResponse struct {
+	Error *apiError `json:"error"`
+}
+
+// apiError is an error returned by the API.
+type apiError struct {
+	Code        int64  `json:"code"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Message, e.Code, e.Description)
+}
+
+// isOrderNotFound returns whether err is the API error of an unknown order.
+func isOrderNotFound(err error) bool {
+	e, ok := err.(*apiError)
+	return ok && e.Code == orderNotFoundCode
+}
+
+// do prepare and process HTTP request to HitBTC API. Parameters are sent in
+// the query string of GET and DELETE requests and form encoded otherwise.
+func (c *client) do(method string, resource string, params map[string]string, authNeeded bool) (response []byte, err error) {
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, value)
+	}
+
+	rawurl := fmt.Sprintf("%s/%s", API_BASE, resource)
+	var body string
+	if method == "GET" || method == "DELETE" {
+		if len(values) > 0 {
+			rawurl += "?" + values.Encode()
+		}
+	} else {
+		body = values.Encode()
+	}
+	req, err := http.NewRequest(method, rawurl, strings.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Add("Accept", "application/json")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if authNeeded {
+		if len(c.apiKey) == 0 || len(c.apiSecret) == 0 {
+			err = errors.New("you need to set API Key and API Secret to call this method")
+			return
+		}
+		req.SetBasicAuth(c.apiKey, c.apiSecret)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	response, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return response, err
+	}
+	if resp.StatusCode != 200 {
+		var r errorResponse
+		if json.Unmarshal(response, &r) == nil && r.Error != nil {
+			return response, r.Error
+		}
+		return response, errors.New(resp.Status)
+	}
+	return response, err
+}
@@ -0,0 +1,315 @@
+// Package hitbtc implements the spiral exchange interfaces against the HitBTC
+// v2 REST API, so the same code can trade on Spiral and HitBTC.
+//
+// Requests and responses use the spiral models: sides are bid and ask, order
+// statuses are translated and candle periods are the spiral kline periods.
+package hitbtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	spiral "github.com/snakehopper/go-spiral"
+)
+
+const (
+	API_BASE = "https://api.hitbtc.com/api/2" // HitBTC API endpoint
+
+	orderNotFoundCode = 20002 // error code of an unknown order
+)
+
+var _ spiral.Exchange = (*HitBTC)(nil)
+
+// HitBTC represent a HitBTC client
+type HitBTC struct {
+	client *client
+}
+
+// New returns an instantiated HitBTC struct
+func New(apiKey, apiSecret string) *HitBTC {
+	return NewWithCustomTimeout(apiKey, apiSecret, 30*time.Second)
+}
+
+// NewWithCustomHttpClient returns an instantiated HitBTC struct with custom http client
+func NewWithCustomHttpClient(apiKey, apiSecret string, httpClient *http.Client) *HitBTC {
+	return &HitBTC{&client{apiKey, apiSecret, httpClient}}
+}
+
+// NewWithCustomTimeout returns an instantiated HitBTC struct with custom timeout
+func NewWithCustomTimeout(apiKey, apiSecret string, timeout time.Duration) *HitBTC {
+	return NewWithCustomHttpClient(apiKey, apiSecret, &http.Client{Timeout: timeout})
+}
+
+// GetCurrencies is used to get all supported currencies at HitBTC along with other meta data.
+func (b *HitBTC) GetCurrencies() (currencies []spiral.Currency, err error) {
+	r, err := b.client.do("GET", "public/currency", nil, false)
+	if err != nil {
+		return
+	}
+	var response []currency
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	for _, c := range response {
+		currencies = append(currencies, c.convert())
+	}
+	return
+}
+
+// GetSymbols is used to get the open and available trading markets at HitBTC along with other meta data.
+func (b *HitBTC) GetSymbols() (symbols []spiral.Symbol, err error) {
+	r, err := b.client.do("GET", "public/symbol", nil, false)
+	if err != nil {
+		return
+	}
+	var response []symbol
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	for _, s := range response {
+		symbols = append(symbols, s.convert())
+	}
+	return
+}
+
+// GetKLines is used to fetch trading symbol kline data. The periods of 2, 6
+// and 12 hours have no HitBTC equivalent.
+func (b *HitBTC) GetKLines(market string, p spiral.Period, limit int) (kline []spiral.KLine, err error) {
+	interval, ok := intervals[p]
+	if !ok {
+		err = fmt.Errorf("hitbtc: unsupported kline period %q", string(p))
+		return
+	}
+	params := map[string]string{
+		"period": interval,
+		"limit":  strconv.Itoa(limit),
+	}
+	r, err := b.client.do("GET", "public/candles/"+url.PathEscape(market), params, false)
+	if err != nil {
+		return
+	}
+	var response []candle
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	for _, c := range response {
+		kline = append(kline, c.convert(p))
+	}
+	return
+}
+
+// GetOrderbook is used to get the current order book for a market.
+func (b *HitBTC) GetOrderbook(market string, limit int) (orderbook spiral.Orderbook, err error) {
+	params := map[string]string{
+		"limit": strconv.Itoa(limit),
+	}
+	r, err := b.client.do("GET", "public/orderbook/"+url.PathEscape(market), params, false)
+	if err != nil {
+		return
+	}
+	// levels are sent best first, as {"price":"…","size":"…"} like spiral.OrderBookItem
+	if err = json.Unmarshal(r, &orderbook); err != nil {
+		return
+	}
+
+	if len(orderbook.Bid) < 1 || len(orderbook.Ask) < 1 {
+		err = fmt.Errorf("GetOrderBook() error, can not get enough Bid or Ask")
+		return
+	}
+	return
+}
+
+// GetBalances is used to retrieve all balances from your trading account
+func (b *HitBTC) GetBalances() (balances []spiral.Balance, err error) {
+	r, err := b.client.do("GET", "trading/balance", nil, true)
+	if err != nil {
+		return
+	}
+	var response []balance
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	for _, bal := range response {
+		balances = append(balances, bal.convert())
+	}
+	return
+}
+
+// GetBalance is used to retrieve the balance from your trading account for a specific currency.
+// currency: a string literal for the currency (ex: LTC)
+func (b *HitBTC) GetBalance(currency string) (balance spiral.Balance, err error) {
+	balances, err := b.GetBalances()
+	if err != nil {
+		return
+	}
+	for _, bal := range balances {
+		if bal.Currency == currency {
+			return bal, nil
+		}
+	}
+	err = errors.New("hitbtc: no balance for currency " + currency)
+	return
+}
+
+// GetTrades used to retrieve your trade history.
+// An empty symbol returns the trades of every market.
+func (b *HitBTC) GetTrades(symbol string, count int) (trades []spiral.Trade, err error) {
+	params := map[string]string{
+		"limit": "1000",
+	}
+	if symbol != "" {
+		params["symbol"] = symbol
+	}
+	if count > 0 {
+		params["limit"] = strconv.Itoa(count)
+	}
+	r, err := b.client.do("GET", "history/trades", params, true)
+	if err != nil {
+		return
+	}
+	var response []trade
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	for _, t := range response {
+		trades = append(trades, t.convert())
+	}
+	return
+}
+
+// CancelOrder cancels the pending order having the exchange id orderId.
+// HitBTC cancels orders by their client order id, so it is looked up in the
+// open orders first.
+func (b *HitBTC) CancelOrder(orderId string) (err error) {
+	id, err := strconv.ParseInt(orderId, 10, 64)
+	if err != nil {
+		return
+	}
+	orders, err := b.GetOpenOrders(0)
+	if err != nil {
+		return
+	}
+	for _, o := range orders {
+		if o.Id == id {
+			return b.CancelOrderByClientID(o.ClientOrderId)
+		}
+	}
+	err = &spiral.OrderNotFoundError{Id: id}
+	return
+}
+
+// CancelOrderByClientID cancels the pending order having the client order id
+// clientOrderId. A spiral.OrderNotFoundError is returned when there is none.
+func (b *HitBTC) CancelOrderByClientID(clientOrderId string) (err error) {
+	_, err = b.client.do("DELETE", "order/"+url.PathEscape(clientOrderId), nil, true)
+	if isOrderNotFound(err) {
+		err = &spiral.OrderNotFoundError{ClientOrderId: clientOrderId}
+	}
+	return
+}
+
+// GetOrderByClientID gets the order having the client order id
+// clientOrderId, looking it up in the order history when it is no longer
+// open. A spiral.OrderNotFoundError is returned when there is none.
+func (b *HitBTC) GetOrderByClientID(clientOrderId string) (o spiral.Orders, err error) {
+	r, err := b.client.do("GET", "order/"+url.PathEscape(clientOrderId), nil, true)
+	if isOrderNotFound(err) {
+		return b.getOrderHistory(clientOrderId)
+	}
+	if err != nil {
+		return
+	}
+	var response order
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	o = response.convert()
+	return
+}
+
+// getOrderHistory gets the closed order having the client order id
+// clientOrderId.
+func (b *HitBTC) getOrderHistory(clientOrderId string) (o spiral.Orders, err error) {
+	params := map[string]string{
+		"clientOrderId": clientOrderId,
+	}
+	r, err := b.client.do("GET", "history/order", params, true)
+	if err != nil {
+		return
+	}
+	var response []order
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	for _, h := range response {
+		if h.ClientOrderID == clientOrderId {
+			return h.convert(), nil
+		}
+	}
+	err = &spiral.OrderNotFoundError{ClientOrderId: clientOrderId}
+	return
+}
+
+// GetOpenOrders gets the open orders of an user.
+func (b *HitBTC) GetOpenOrders(count int) (orders []spiral.Orders, err error) {
+	r, err := b.client.do("GET", "order", nil, true)
+	if err != nil {
+		return
+	}
+	var response []order
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	for _, o := range response {
+		if count > 0 && len(orders) == count {
+			break
+		}
+		orders = append(orders, o.convert())
+	}
+	return
+}
+
+// PlaceOrder creates a new order. HitBTC generates the client order id when
+// requestOrder has none.
+func (b *HitBTC) PlaceOrder(requestOrder spiral.Orders) (resp spiral.PlaceReturn, err error) {
+	payload := make(map[string]string)
+
+	if requestOrder.ClientOrderId != "" {
+		payload["clientOrderId"] = requestOrder.ClientOrderId
+	}
+	payload["symbol"] = requestOrder.Symbol
+	payload["side"] = "buy"
+	if requestOrder.Side == spiral.AskSide {
+		payload["side"] = "sell"
+	}
+	payload["type"] = string(requestOrder.Type)
+	payload["quantity"] = spiral.FormatAmount(requestOrder.Quantity)
+	if requestOrder.Type != spiral.MarketOrderType {
+		payload["price"] = spiral.FormatAmount(requestOrder.Price)
+	}
+
+	r, err := b.client.do("POST", "order", payload, true)
+	if err != nil {
+		return
+	}
+	var response order
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+
+	resp.Order = response.placeData()
+	return
+}
@@ -0,0 +1,261 @@
+package hitbtc
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	spiral "github.com/snakehopper/go-spiral"
+)
+
+// rewriteHost sends every request to the host of base.
+type rewriteHost struct {
+	base *url.URL
+}
+
+func (r rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = r.base.Scheme
+	req.URL.Host = r.base.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// request is a request received by a hitbtcServer.
+type request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// hitbtcServer answers the requests with the responses of the HitBTC API
+// documentation, and records the last request received.
+type hitbtcServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	last request
+}
+
+var responses = map[string]string{
+	"/api/2/public/currency":                               `[{"id":"ETH","fullName":"Ethereum","crypto":true,"payinEnabled":true,"payinPaymentId":false,"payinConfirmations":2,"payoutEnabled":true,"payoutIsPaymentId":false,"transferEnabled":true,"delisted":false,"payoutFee":"0.042800000000"}]`,
+	"/api/2/public/symbol":                                 `[{"id":"ETHBTC","baseCurrency":"ETH","quoteCurrency":"BTC","quantityIncrement":"0.001","tickSize":"0.000001","takeLiquidityRate":"0.001","provideLiquidityRate":"-0.0001","feeCurrency":"BTC"}]`,
+	"/api/2/public/candles/ETHBTC":                         `[{"timestamp":"2017-10-20T20:00:00.000Z","open":"0.050459","close":"0.050087","min":"0.050000","max":"0.050511","volume":"1326.628","volumeQuote":"66.555987736"}]`,
+	"/api/2/public/orderbook/ETHBTC":                       `{"ask":[{"price":"0.046002","size":"0.088"},{"price":"0.046800","size":"0.200"}],"bid":[{"price":"0.046001","size":"0.005"},{"price":"0.046000","size":"0.200"}],"timestamp":"2018-11-19T05:00:28.193Z"}`,
+	"/api/2/public/orderbook/EMPTY":                        `{"ask":[],"bid":[],"timestamp":"2018-11-19T05:00:28.193Z"}`,
+	"/api/2/trading/balance":                               `[{"currency":"ETH","available":"10.000000000","reserved":"0.560000000"},{"currency":"BTC","available":"0.010205869","reserved":"0"}]`,
+	"/api/2/history/trades":                                `[{"id":9535486,"clientOrderId":"f8dbaab336d44d5ba3ff578098a68454","orderId":816088377,"symbol":"ETHBTC","side":"sell","quantity":"0.061","price":"0.045487","fee":"0.000002775","timestamp":"2017-05-17T12:32:57.848Z"}]`,
+	"GET /api/2/order":                                     `[{"id":840450210,"clientOrderId":"c1837634ef81472a9cd13c81e7b91401","symbol":"ETHBTC","side":"buy","status":"partiallyFilled","type":"limit","timeInForce":"GTC","quantity":"0.020","price":"0.046001","cumQuantity":"0.005","createdAt":"2017-05-12T17:17:57.437Z","updatedAt":"2017-05-12T17:18:08.610Z"},{"id":840450211,"clientOrderId":"c1837634ef81472a9cd13c81e7b91402","symbol":"ETHBTC","side":"sell","status":"new","type":"limit","timeInForce":"GTC","quantity":"0.020","price":"0.047000","cumQuantity":"0.000","createdAt":"2017-05-12T17:17:57.437Z","updatedAt":"2017-05-12T17:17:57.437Z"}]`,
+	"POST /api/2/order":                                    `{"id":4345613661,"clientOrderId":"57d5525562c945448e3cbd559bd068c3","symbol":"BCCBTC","side":"sell","status":"new","type":"limit","timeInForce":"GTC","quantity":"0.013","price":"0.100000","cumQuantity":"0.000","createdAt":"2017-10-20T12:17:12.245Z","updatedAt":"2017-10-20T12:17:12.245Z"}`,
+	"/api/2/order/57d5525562c945448e3":                     `{"id":4345613661,"clientOrderId":"57d5525562c945448e3","symbol":"BCCBTC","side":"sell","status":"filled","type":"limit","timeInForce":"GTC","quantity":"0.013","price":"0.100000","cumQuantity":"0.013","createdAt":"2017-10-20T12:17:12.245Z","updatedAt":"2017-10-20T12:20:05.952Z"}`,
+	"DELETE /api/2/order/c1837634ef81472a9cd13c81e7b91402": `{"id":840450211,"clientOrderId":"c1837634ef81472a9cd13c81e7b91402","symbol":"ETHBTC","side":"sell","status":"canceled","type":"limit","timeInForce":"GTC","quantity":"0.020","price":"0.047000","cumQuantity":"0.000","createdAt":"2017-05-12T17:17:57.437Z","updatedAt":"2017-05-12T17:20:01.010Z"}`,
+	"/api/2/history/order":                                 `[{"id":828680665,"clientOrderId":"f4307c6e507e49019907c917b6d7a084","symbol":"ETHBTC","side":"sell","status":"filled","type":"limit","timeInForce":"GTC","quantity":"13.942","price":"0.011384","cumQuantity":"13.942","createdAt":"2017-05-12T11:42:42.225Z","updatedAt":"2017-05-12T11:42:42.225Z"}]`,
+}
+
+func newHitBTCServer(t *testing.T) (*hitbtcServer, *HitBTC) {
+	s := &hitbtcServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.last = request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Body: string(body)}
+		s.mu.Unlock()
+
+		if user, password, ok := r.BasicAuth(); ok && (user != "key" || password != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":1002,"message":"Authorization required","description":""}}`))
+			return
+		}
+		response, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			response, ok = responses[r.URL.Path]
+		}
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":20002,"message":"Order not found","description":""}}`))
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(s.Close)
+	return s, s.client("key", "secret")
+}
+
+// client returns a client of the server authenticated with apiKey and apiSecret.
+func (s *hitbtcServer) client(apiKey, apiSecret string) *HitBTC {
+	base, _ := url.Parse(s.URL)
+	return NewWithCustomHttpClient(apiKey, apiSecret, &http.Client{Transport: rewriteHost{base}})
+}
+
+func (s *hitbtcServer) request() request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func TestMarketData(t *testing.T) {
+	server, api := newHitBTCServer(t)
+
+	currencies, err := api.GetCurrencies()
+	if err != nil || len(currencies) != 1 {
+		t.Fatal(currencies, err)
+	}
+	if c := currencies[0]; c.Code != "ETH" || c.Name != "Ethereum" || !c.CanDeposit || c.MinConfirms != 2 || c.WithdrawalFee != 0.0428 {
+		t.Errorf("currency = %+v", c)
+	}
+
+	symbols, err := api.GetSymbols()
+	if err != nil || len(symbols) != 1 {
+		t.Fatal(symbols, err)
+	}
+	if s := symbols[0]; s.Symbol != "ETHBTC" || s.BaseAsset != "ETH" || s.QuoteAsset != "BTC" || s.TickSize != 0.000001 || s.MinTrade != 0.001 {
+		t.Errorf("symbol = %+v", s)
+	}
+
+	klines, err := api.GetKLines("ETHBTC", spiral.Period1Hour, 10)
+	if err != nil || len(klines) != 1 {
+		t.Fatal(klines, err)
+	}
+	if r := server.request(); r.Query != "limit=10&period=H1" {
+		t.Errorf("candles query = %s", r.Query)
+	}
+	if k := klines[0]; k.Open != 0.050459 || k.High != 0.050511 || k.Low != 0.05 || k.Close != 0.050087 ||
+		k.CloseTs.Sub(k.OpenTs.Time) != spiral.Period1Hour.Duration()-1e6 {
+		t.Errorf("kline = %+v", k)
+	}
+	if _, err := api.GetKLines("ETHBTC", spiral.Period2Hours, 10); err == nil {
+		t.Error("GetKLines of an unsupported period succeeded")
+	}
+
+	book, err := api.GetOrderbook("ETHBTC", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Bid) != 2 || book.Bid[0].Price != 0.046001 || len(book.Ask) != 2 || book.Ask[0].Size != 0.088 {
+		t.Errorf("orderbook = %+v", book)
+	}
+	if _, err := api.GetOrderbook("EMPTY", 5); err == nil {
+		t.Error("GetOrderbook of an empty book succeeded")
+	}
+}
+
+func TestAccount(t *testing.T) {
+	server, api := newHitBTCServer(t)
+
+	balance, err := api.GetBalance("ETH")
+	if err != nil || balance.Available != 10 || balance.Locked != 0.56 {
+		t.Errorf("balance = %+v, %v", balance, err)
+	}
+	if _, err := api.GetBalance("XRP"); err == nil {
+		t.Error("GetBalance of a missing currency succeeded")
+	}
+
+	trades, err := api.GetTrades("ETHBTC", 5)
+	if err != nil || len(trades) != 1 {
+		t.Fatal(trades, err)
+	}
+	if r := server.request(); r.Query != "limit=5&symbol=ETHBTC" {
+		t.Errorf("trades query = %s", r.Query)
+	}
+	if tr := trades[0]; tr.ID != 9535486 || tr.Side != string(spiral.AskSide) || tr.Price != 0.045487 || tr.Fee != 0.000002775 {
+		t.Errorf("trade = %+v", tr)
+	}
+
+	if _, err := NewWithCustomHttpClient("", "", nil).GetBalances(); err == nil {
+		t.Error("GetBalances without credentials succeeded")
+	}
+	_, err = server.client("key", "wrong").GetBalances()
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Code != 1002 {
+		t.Errorf("GetBalances with wrong credentials = %v", err)
+	}
+}
+
+func TestTrading(t *testing.T) {
+	server, api := newHitBTCServer(t)
+
+	placed, err := api.PlaceOrder(spiral.Orders{
+		ClientOrderId: "57d5525562c945448e3cbd559bd068c3",
+		Symbol:        "BCCBTC",
+		Side:          spiral.AskSide,
+		Type:          spiral.LimitOrderType,
+		Quantity:      0.013,
+		Price:         0.1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "clientOrderId=57d5525562c945448e3cbd559bd068c3&price=0.1&quantity=0.013&side=sell&symbol=BCCBTC&type=limit"
+	if r := server.request(); r.Method != "POST" || r.Body != want {
+		t.Errorf("PlaceOrder sent %s %s, want %s", r.Method, r.Body, want)
+	}
+	if o := placed.Order; o.Id != 4345613661 || o.Side != spiral.AskSide || o.Status != spiral.Accepted || o.Price != 0.1 {
+		t.Errorf("placed = %+v", o)
+	}
+
+	open, err := api.GetOpenOrders(1)
+	if err != nil || len(open) != 1 {
+		t.Fatal(open, err)
+	}
+	if o := open[0]; o.Side != spiral.BidSide || o.Status != spiral.PartialFilled || o.FilledQuantity != 0.005 {
+		t.Errorf("open order = %+v", o)
+	}
+
+	order, err := api.GetOrderByClientID("57d5525562c945448e3")
+	if err != nil || order.Status != spiral.Filled || order.FilledQuantity != 0.013 {
+		t.Errorf("order = %+v, %v", order, err)
+	}
+	closed, err := api.GetOrderByClientID("f4307c6e507e49019907c917b6d7a084")
+	if err != nil || closed.Id != 828680665 || closed.Status != spiral.Filled {
+		t.Errorf("closed order = %+v, %v", closed, err)
+	}
+	if r := server.request(); r.Path != "/api/2/history/order" || r.Query != "clientOrderId=f4307c6e507e49019907c917b6d7a084" {
+		t.Errorf("closed order looked up with %s?%s", r.Path, r.Query)
+	}
+	_, err = api.GetOrderByClientID("missing")
+	var notFound *spiral.OrderNotFoundError
+	if !errors.As(err, &notFound) || notFound.ClientOrderId != "missing" {
+		t.Errorf("GetOrderByClientID of a missing order = %v", err)
+	}
+
+	if err := api.CancelOrderByClientID("57d5525562c945448e3"); err != nil {
+		t.Error(err)
+	}
+	if r := server.request(); r.Method != "DELETE" || r.Path != "/api/2/order/57d5525562c945448e3" {
+		t.Errorf("CancelOrderByClientID sent %s %s", r.Method, r.Path)
+	}
+	err = api.CancelOrderByClientID("missing")
+	if !errors.As(err, &notFound) || notFound.ClientOrderId != "missing" {
+		t.Errorf("CancelOrderByClientID of a missing order = %v", err)
+	}
+
+	// orders are cancelled by their exchange id like on Spiral
+	if err := api.CancelOrder("840450211"); err != nil {
+		t.Error(err)
+	}
+	if r := server.request(); r.Method != "DELETE" || r.Path != "/api/2/order/c1837634ef81472a9cd13c81e7b91402" {
+		t.Errorf("CancelOrder sent %s %s", r.Method, r.Path)
+	}
+	err = api.CancelOrder("1")
+	if !errors.As(err, &notFound) || notFound.Id != 1 {
+		t.Errorf("CancelOrder of a missing order = %v", err)
+	}
+}
+
+// The orders of a tracker are polled by their client order id.
+func TestOrderTrackerPoll(t *testing.T) {
+	_, api := newHitBTCServer(t)
+
+	tracker := spiral.NewOrderTracker(8)
+	if err := tracker.Track(spiral.Orders{ClientOrderId: "57d5525562c945448e3", Symbol: "BCCBTC", Status: spiral.Accepted, Quantity: 0.013}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Poll(api); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := tracker.Order("57d5525562c945448e3"); !ok || o.Status != spiral.Filled {
+		t.Errorf("polled order = %+v, %v", o, ok)
+	}
+}
@@ -0,0 +1,202 @@
+package hitbtc
+
+import (
+	"time"
+
+	spiral "github.com/snakehopper/go-spiral"
+)
+
+// intervals maps the kline periods to the candle periods of the API.
+var intervals = map[spiral.Period]string{
+	spiral.Period1Minute:   "M1",
+	spiral.Period3Minutes:  "M3",
+	spiral.Period5Minutes:  "M5",
+	spiral.Period15Minutes: "M15",
+	spiral.Period30Minutes: "M30",
+	spiral.Period1Hour:     "H1",
+	spiral.Period4Hours:    "H4",
+	spiral.Period1Day:      "D1",
+	spiral.Period1Week:     "D7",
+	spiral.Period1Month:    "1M",
+}
+
+type currency struct {
+	ID                 string  `json:"id"`
+	FullName           string  `json:"fullName"`
+	Crypto             bool    `json:"crypto"`
+	PayinEnabled       bool    `json:"payinEnabled"`
+	PayoutEnabled      bool    `json:"payoutEnabled"`
+	PayinConfirmations int64   `json:"payinConfirmations"`
+	PayoutFee          float64 `json:"payoutFee,string"`
+}
+
+func (c currency) convert() spiral.Currency {
+	return spiral.Currency{
+		Code:          c.ID,
+		Name:          c.FullName,
+		CanDeposit:    c.PayinEnabled,
+		CanWithdrawal: c.PayoutEnabled,
+		MinConfirms:   c.PayinConfirmations,
+		WithdrawalFee: c.PayoutFee,
+	}
+}
+
+type symbol struct {
+	ID                string  `json:"id"`
+	BaseCurrency      string  `json:"baseCurrency"`
+	QuoteCurrency     string  `json:"quoteCurrency"`
+	QuantityIncrement float64 `json:"quantityIncrement,string"`
+	TickSize          float64 `json:"tickSize,string"`
+	FeeCurrency       string  `json:"feeCurrency"`
+}
+
+// convert returns the symbol, every symbol listed being tradable.
+func (s symbol) convert() spiral.Symbol {
+	return spiral.Symbol{
+		Symbol:     s.ID,
+		BaseAsset:  s.BaseCurrency,
+		QuoteAsset: s.QuoteCurrency,
+		TickSize:   s.TickSize,
+		MinTrade:   s.QuantityIncrement,
+		Active:     true,
+	}
+}
+
+type candle struct {
+	Timestamp   spiral.Timestamp `json:"timestamp"`
+	Open        float64          `json:"open,string"`
+	Close       float64          `json:"close,string"`
+	Min         float64          `json:"min,string"`
+	Max         float64          `json:"max,string"`
+	Volume      float64          `json:"volume,string"`
+	VolumeQuote float64          `json:"volumeQuote,string"`
+}
+
+// convert returns the kline of period p, closing a millisecond before the
+// next one opens.
+func (c candle) convert(p spiral.Period) spiral.KLine {
+	next := c.Timestamp.Add(p.Duration())
+	if p == spiral.Period1Month {
+		next = c.Timestamp.AddDate(0, 1, 0)
+	}
+	return spiral.KLine{
+		OpenTs:  c.Timestamp,
+		Open:    c.Open,
+		High:    c.Max,
+		Low:     c.Min,
+		Close:   c.Close,
+		Vol:     c.Volume,
+		CloseTs: spiral.Timestamp{Time: next.Add(-time.Millisecond)},
+	}
+}
+
+type balance struct {
+	Currency  string  `json:"currency"`
+	Available float64 `json:"available,string"`
+	Reserved  float64 `json:"reserved,string"`
+}
+
+func (b balance) convert() spiral.Balance {
+	return spiral.Balance{
+		Currency:  b.Currency,
+		Available: b.Available,
+		Locked:    b.Reserved,
+	}
+}
+
+type trade struct {
+	ID            int64            `json:"id"`
+	ClientOrderID string           `json:"clientOrderId"`
+	OrderID       int64            `json:"orderId"`
+	Symbol        string           `json:"symbol"`
+	Side          string           `json:"side"`
+	Quantity      float64          `json:"quantity,string"`
+	Price         float64          `json:"price,string"`
+	Fee           float64          `json:"fee,string"`
+	Timestamp     spiral.Timestamp `json:"timestamp"`
+}
+
+func (t trade) convert() spiral.Trade {
+	side := string(spiral.BidSide)
+	if t.Side == "sell" {
+		side = string(spiral.AskSide)
+	}
+	return spiral.Trade{
+		ID:        t.ID,
+		Side:      side,
+		Symbol:    t.Symbol,
+		Price:     t.Price,
+		Quantity:  t.Quantity,
+		Fee:       t.Fee,
+		Timestamp: t.Timestamp,
+	}
+}
+
+type order struct {
+	ID            int64            `json:"id"`
+	ClientOrderID string           `json:"clientOrderId"`
+	Symbol        string           `json:"symbol"`
+	Side          string           `json:"side"`
+	Status        string           `json:"status"`
+	Type          string           `json:"type"`
+	TimeInForce   string           `json:"timeInForce"`
+	Quantity      float64          `json:"quantity,string"`
+	Price         float64          `json:"price,string"`
+	CumQuantity   float64          `json:"cumQuantity,string"`
+	CreatedAt     spiral.Timestamp `json:"createdAt"`
+	UpdatedAt     spiral.Timestamp `json:"updatedAt"`
+}
+
+// convert returns the order. Stop orders are returned as limit or market
+// orders and expired orders as cancelled.
+func (o order) convert() spiral.Orders {
+	r := spiral.Orders{
+		Id:             o.ID,
+		ClientOrderId:  o.ClientOrderID,
+		Symbol:         o.Symbol,
+		Side:           spiral.BidSide,
+		Price:          o.Price,
+		Quantity:       o.Quantity,
+		FilledQuantity: o.CumQuantity,
+		Type:           spiral.LimitOrderType,
+		Status:         spiral.Unknown,
+		CreateTime:     o.CreatedAt,
+		UpdateTime:     o.UpdatedAt,
+	}
+	if o.Side == "sell" {
+		r.Side = spiral.AskSide
+	}
+	if o.Type == "market" || o.Type == "stopMarket" {
+		r.Type = spiral.MarketOrderType
+	}
+	switch o.Status {
+	case "new":
+		r.Status = spiral.Accepted
+	case "suspended":
+		r.Status = spiral.Waiting
+	case "partiallyFilled":
+		r.Status = spiral.PartialFilled
+	case "filled":
+		r.Status = spiral.Filled
+	case "canceled", "expired":
+		r.Status = spiral.Cancelled
+	}
+	return r
+}
+
+// placeData returns the order as PlaceOrder returns it.
+func (o order) placeData() spiral.PlaceData {
+	r := o.convert()
+	return spiral.PlaceData{
+		Id:            r.Id,
+		ClientOrderId: r.ClientOrderId,
+		Symbol:        r.Symbol,
+		Side:          r.Side,
+		Price:         r.Price,
+		Quantity:      r.Quantity,
+		Type:          r.Type,
+		Status:        r.Status,
+		CreateTime:    r.CreateTime,
+		UpdateTime:    r.UpdateTime,
+	}
+}
@@ -1,50 +1,52 @@
 package spiral
 
 import (
-	"encoding/json"
 	"strconv"
+	"time"
 )
 
+// Duration returns the length of a candle of period p. Months are counted as 30 days.
+func (p Period) Duration() time.Duration {
+	minutes, err := strconv.Atoi(string(p))
+	if err != nil || minutes <= 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
 type KLine struct {
-	OpenTs        int64
+	OpenTs        Timestamp
 	Open          float64
 	High          float64
 	Low           float64
 	Close         float64
 	Vol           float64
-	CloseTs       int64
+	CloseTs       Timestamp
 	RESERVED      string
 	NumberOfTrade int64
 }
 
+// UnmarshalJSON decodes the [openTs, open, high, low, close, vol, closeTs, reserved, trades]
+// array sent by the API. Numbers may be encoded as JSON strings or numbers.
 func (r *KLine) UnmarshalJSON(bs []byte) error {
-	arr := []interface{}{}
-	if err := json.Unmarshal(bs, &arr); err != nil {
-		return err
-	}
+	d := newArrayDecoder("KLine", bs, 9)
 
-	var err error
-
-	r.OpenTs = int64(arr[0].(float64))
-	if r.Open, err = strconv.ParseFloat(arr[1].(string), 64); err != nil {
-		return err
-	}
-	if r.High, err = strconv.ParseFloat(arr[2].(string), 64); err != nil {
-		return err
-	}
-	if r.Low, err = strconv.ParseFloat(arr[3].(string), 64); err != nil {
-		return err
-	}
-	if r.Close, err = strconv.ParseFloat(arr[4].(string), 64); err != nil {
-		return err
+	k := KLine{
+		OpenTs:        d.time(0, "OpenTs"),
+		Open:          d.float(1, "Open"),
+		High:          d.float(2, "High"),
+		Low:           d.float(3, "Low"),
+		Close:         d.float(4, "Close"),
+		Vol:           d.float(5, "Vol"),
+		CloseTs:       d.time(6, "CloseTs"),
+		RESERVED:      d.string(7, "RESERVED"),
+		NumberOfTrade: d.int(8, "NumberOfTrade"),
 	}
-	if r.Vol, err = strconv.ParseFloat(arr[5].(string), 64); err != nil {
-		return err
+	if d.err != nil {
+		return d.err
 	}
-	r.CloseTs = int64(arr[6].(float64))
-	r.RESERVED = arr[7].(string)
-	r.NumberOfTrade = int64(arr[8].(float64))
 
+	*r = k
 	return nil
 }
 
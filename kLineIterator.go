@@ -0,0 +1,138 @@
+package spiral
+
+import (
+	"sort"
+	"time"
+)
+
+const defaultKLineChunkSize = 500
+
+// KLineGap is a run of missing candles, from the open time of the first
+// missing candle up to the open time of the next candle received.
+type KLineGap struct {
+	From time.Time
+	To   time.Time
+}
+
+// KLineIterator back-fills a long kline history in chunks.
+//
+// Candles overlapping a previous chunk are dropped and missing intervals are
+// recorded in Gaps.
+//
+//	it := api.NewKLineIterator("ETHBTC", spiral.Period1Hour, start, end, 0)
+//	for it.Next() {
+//		candles = append(candles, it.KLines()...)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type KLineIterator struct {
+	api    *Spiral
+	market string
+	period Period
+	end    time.Time
+	limit  int
+
+	cursor time.Time // open time of the next expected candle
+	chunk  []KLine
+	gaps   []KLineGap
+	err    error
+	done   bool
+}
+
+// NewKLineIterator returns an iterator over the klines of market opened between
+// start and end. A zero end iterates up to the latest candle. chunkSize is the
+// limit sent with each request, 500 when not positive.
+func (b *Spiral) NewKLineIterator(market string, p Period, start, end time.Time, chunkSize int) *KLineIterator {
+	if chunkSize <= 0 {
+		chunkSize = defaultKLineChunkSize
+	}
+	it := &KLineIterator{
+		api:    b,
+		market: market,
+		period: p,
+		end:    end,
+		limit:  chunkSize,
+		cursor: start,
+	}
+	if d := p.Duration(); d > 0 {
+		if aligned := start.Truncate(d); aligned.Before(start) {
+			it.cursor = aligned.Add(d)
+		}
+	}
+	return it
+}
+
+// Next fetches the next chunk of candles. It returns false when the range is
+// exhausted or an error occurred.
+func (it *KLineIterator) Next() bool {
+	it.chunk = nil
+	if it.done {
+		return false
+	}
+
+	klines, err := it.api.GetKLinesInRange(it.market, it.period, it.cursor, it.end, it.limit)
+	if err != nil {
+		it.err = err
+		it.done = true
+		return false
+	}
+	if len(klines) < it.limit {
+		it.done = true
+	}
+
+	sort.SliceStable(klines, func(i, j int) bool {
+		return klines[i].OpenTs.Before(klines[j].OpenTs.Time)
+	})
+	for _, k := range klines {
+		if k.OpenTs.Before(it.cursor) {
+			continue // overlaps the previous chunk
+		}
+		if !it.end.IsZero() && !k.OpenTs.Before(it.end) {
+			it.done = true
+			break
+		}
+		it.accept(k)
+	}
+
+	if len(it.chunk) == 0 {
+		// a full page without anything new would loop forever
+		it.done = true
+		return false
+	}
+	if !it.end.IsZero() && !it.cursor.Before(it.end) {
+		it.done = true
+	}
+	return true
+}
+
+// accept appends k to the current chunk, recording the gap before it if any.
+func (it *KLineIterator) accept(k KLine) {
+	d := it.period.Duration()
+	if d <= 0 {
+		it.chunk = append(it.chunk, k)
+		it.cursor = k.OpenTs.Add(time.Nanosecond)
+		return
+	}
+
+	if !it.cursor.IsZero() && k.OpenTs.After(it.cursor) {
+		it.gaps = append(it.gaps, KLineGap{From: it.cursor, To: k.OpenTs.Time})
+	}
+	it.chunk = append(it.chunk, k)
+	it.cursor = k.OpenTs.Add(d)
+}
+
+// KLines returns the chunk fetched by the last call to Next.
+func (it *KLineIterator) KLines() []KLine {
+	return it.chunk
+}
+
+// Gaps returns the missing intervals detected so far.
+func (it *KLineIterator) Gaps() []KLineGap {
+	return it.gaps
+}
+
+// Err returns the first error met while iterating.
+func (it *KLineIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,89 @@
+package spiral
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// klineServer serves the minute klines opened at the given minutes after t0,
+// starting at start_time and up to limit candles, repeating the candle
+// before start_time like the API does with overlapping ranges.
+func klineServer(t *testing.T, t0 time.Time, minutes []int) *Spiral {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, _ := strconv.ParseInt(q.Get("start_time"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+
+		data := [][]interface{}{}
+		for i, m := range minutes {
+			open := t0.Add(time.Duration(m) * time.Minute)
+			overlap := i+1 < len(minutes) && t0.Add(time.Duration(minutes[i+1])*time.Minute).UnixMilli() > start
+			if (open.UnixMilli() >= start || overlap) && len(data) < limit {
+				data = append(data, []interface{}{open.UnixMilli(), "1", "2", "0.5", "1.5", "10", open.Add(time.Minute).UnixMilli() - 1, nil, 3})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+	base, _ := url.Parse(server.URL)
+	return NewWithCustomHttpClient("", "", &http.Client{Transport: rewriteHost{base}})
+}
+
+func TestKLineIterator(t *testing.T) {
+	t0 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := klineServer(t, t0, []int{0, 1, 2, 4, 5, 8, 9})
+
+	it := api.NewKLineIterator("BTCUSDT", Period1Minute, t0, t0.Add(9*time.Minute), 3)
+	var chunks [][]int
+	for it.Next() {
+		var chunk []int
+		for _, k := range it.KLines() {
+			chunk = append(chunk, int(k.OpenTs.Sub(t0)/time.Minute))
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if it.Next() {
+		t.Error("Next returned true once exhausted")
+	}
+
+	want := [][]int{{0, 1, 2}, {4, 5}, {8}}
+	if len(chunks) != len(want) {
+		t.Fatalf("chunks = %v, want %v", chunks, want)
+	}
+	for i := range want {
+		if len(chunks[i]) != len(want[i]) {
+			t.Fatalf("chunks = %v, want %v", chunks, want)
+		}
+		for j := range want[i] {
+			if chunks[i][j] != want[i][j] {
+				t.Fatalf("chunks = %v, want %v", chunks, want)
+			}
+		}
+	}
+
+	gaps := it.Gaps()
+	if len(gaps) != 2 || !gaps[0].From.Equal(t0.Add(3*time.Minute)) || !gaps[0].To.Equal(t0.Add(4*time.Minute)) ||
+		!gaps[1].From.Equal(t0.Add(6*time.Minute)) || !gaps[1].To.Equal(t0.Add(8*time.Minute)) {
+		t.Errorf("gaps = %+v", gaps)
+	}
+}
+
+func TestKLineIteratorError(t *testing.T) {
+	api := newReplayAPI(t, "testdata/replay")
+
+	it := api.NewKLineIterator("ETHBTC", Period1Hour, time.Now().Add(-time.Hour), time.Time{}, 0)
+	if it.Next() || it.Err() == nil {
+		t.Errorf("Next without fixture = true, %v", it.Err())
+	}
+	if it.Next() {
+		t.Error("Next returned true after an error")
+	}
+}
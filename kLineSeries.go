@@ -0,0 +1,222 @@
+package spiral
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// periodBounds returns the open time of the period p candle containing t and
+// the open time of the following one. Candles are aligned on UTC, weeks start
+// on Monday and months on their first day.
+func periodBounds(p Period, t time.Time) (open, next time.Time, err error) {
+	t = t.UTC()
+	if p == Period1Month {
+		open = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return open, open.AddDate(0, 1, 0), nil
+	}
+	d := p.Duration()
+	if d <= 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("spiral: unknown kline period %q", string(p))
+	}
+	open = t.Truncate(d)
+	return open, open.Add(d), nil
+}
+
+// closeTime is the close time of a candle, one millisecond before the next one opens at next.
+func closeTime(next time.Time) Timestamp {
+	return Timestamp{next.Add(-time.Millisecond)}
+}
+
+func sortKLines(klines []KLine) []KLine {
+	sorted := append([]KLine(nil), klines...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].OpenTs.Before(sorted[j].OpenTs.Time)
+	})
+	return sorted
+}
+
+// ResampleKLines aggregates klines into candles of the longer period p.
+//
+// The open is taken from the first candle and the close from the last one of
+// each period, highs, lows, volumes and trade counts are combined.
+func ResampleKLines(klines []KLine, p Period) ([]KLine, error) {
+	var out []KLine
+	var next time.Time
+	for _, k := range sortKLines(klines) {
+		open, end, err := periodBounds(p, k.OpenTs.Time)
+		if err != nil {
+			return nil, err
+		}
+		if !k.CloseTs.IsZero() && k.CloseTs.After(end) {
+			return nil, fmt.Errorf("spiral: kline opened at %v is longer than period %q", k.OpenTs.Time, string(p))
+		}
+
+		if len(out) == 0 || !next.Equal(end) {
+			next = end
+			out = append(out, KLine{
+				OpenTs:        Timestamp{open},
+				Open:          k.Open,
+				High:          k.High,
+				Low:           k.Low,
+				Close:         k.Close,
+				Vol:           k.Vol,
+				CloseTs:       closeTime(end),
+				NumberOfTrade: k.NumberOfTrade,
+			})
+			continue
+		}
+
+		last := &out[len(out)-1]
+		if k.High > last.High {
+			last.High = k.High
+		}
+		if k.Low < last.Low {
+			last.Low = k.Low
+		}
+		last.Close = k.Close
+		last.Vol += k.Vol
+		last.NumberOfTrade += k.NumberOfTrade
+	}
+	return out, nil
+}
+
+// FillKLineGaps returns klines with every missing period p candle replaced by
+// a flat candle at the previous close, without volume nor trades.
+func FillKLineGaps(klines []KLine, p Period) ([]KLine, error) {
+	sorted := sortKLines(klines)
+	var out []KLine
+	for i, k := range sorted {
+		if i > 0 {
+			prev := out[len(out)-1]
+			_, next, err := periodBounds(p, prev.OpenTs.Time)
+			if err != nil {
+				return nil, err
+			}
+			for next.Before(k.OpenTs.Time) {
+				_, after, _ := periodBounds(p, next)
+				out = append(out, flatKLine(prev.Close, next, after))
+				next = after
+			}
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func flatKLine(price float64, open, next time.Time) KLine {
+	return KLine{
+		OpenTs:  Timestamp{open},
+		Open:    price,
+		High:    price,
+		Low:     price,
+		Close:   price,
+		CloseTs: closeTime(next),
+	}
+}
+
+// KLine converts a WebSocket candle of period p to a KLine. The WebSocket
+// feed does not send trade counts.
+func (c WSCandles) KLine(p Period) (KLine, error) {
+	_, next, err := periodBounds(p, c.Timestamp.Time)
+	if err != nil {
+		return KLine{}, err
+	}
+	return KLine{
+		OpenTs:  c.Timestamp,
+		Open:    c.Open.Float64(),
+		High:    c.Max.Float64(),
+		Low:     c.Min.Float64(),
+		Close:   c.Close.Float64(),
+		Vol:     c.Volume.Float64(),
+		CloseTs: closeTime(next),
+	}, nil
+}
+
+// KLineSeries is a rolling, thread-safe series of period p candles fed by REST
+// history and live WebSocket updates. Updates to an existing candle replace it.
+type KLineSeries struct {
+	mu       sync.RWMutex
+	period   Period
+	size     int
+	fillGaps bool
+	klines   []KLine
+}
+
+// NewKLineSeries returns a series keeping the last size candles, or all of them
+// when size is not positive. When fillGaps is set, missing candles are filled
+// with flat candles as newer ones arrive.
+func NewKLineSeries(p Period, size int, fillGaps bool) *KLineSeries {
+	return &KLineSeries{period: p, size: size, fillGaps: fillGaps}
+}
+
+// Add inserts or replaces candles by open time.
+func (s *KLineSeries) Add(klines ...KLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range klines {
+		n := len(s.klines)
+		i := sort.Search(n, func(i int) bool {
+			return !s.klines[i].OpenTs.Before(k.OpenTs.Time)
+		})
+		switch {
+		case i < n && s.klines[i].OpenTs.Equal(k.OpenTs.Time):
+			s.klines[i] = k
+		case i == n:
+			s.klines = append(s.klines, k)
+		default:
+			s.klines = append(s.klines, KLine{})
+			copy(s.klines[i+1:], s.klines[i:])
+			s.klines[i] = k
+		}
+	}
+
+	if s.fillGaps {
+		filled, err := FillKLineGaps(s.klines, s.period)
+		if err != nil {
+			return err
+		}
+		s.klines = filled
+	}
+	if s.size > 0 && len(s.klines) > s.size {
+		s.klines = append([]KLine(nil), s.klines[len(s.klines)-s.size:]...)
+	}
+	return nil
+}
+
+// MergeCandles adds the candles of a WebSocket snapshot or update.
+func (s *KLineSeries) MergeCandles(candles ...WSCandles) error {
+	klines := make([]KLine, 0, len(candles))
+	for _, c := range candles {
+		k, err := c.KLine(s.period)
+		if err != nil {
+			return err
+		}
+		klines = append(klines, k)
+	}
+	return s.Add(klines...)
+}
+
+// KLines returns a copy of the series, oldest first.
+func (s *KLineSeries) KLines() []KLine {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]KLine(nil), s.klines...)
+}
+
+// Last returns the most recent candle.
+func (s *KLineSeries) Last() (KLine, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.klines) == 0 {
+		return KLine{}, false
+	}
+	return s.klines[len(s.klines)-1], true
+}
+
+// Resample returns the series aggregated into candles of the longer period p.
+func (s *KLineSeries) Resample(p Period) ([]KLine, error) {
+	return ResampleKLines(s.KLines(), p)
+}
@@ -0,0 +1,307 @@
+package spiral
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func utc(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// kline returns the candle of period p opened at open.
+func kline(p Period, open string, o, h, l, c, vol float64, trades int64) KLine {
+	_, next, err := periodBounds(p, utc(open))
+	if err != nil {
+		panic(err)
+	}
+	return KLine{
+		OpenTs:        Timestamp{utc(open)},
+		Open:          o,
+		High:          h,
+		Low:           l,
+		Close:         c,
+		Vol:           vol,
+		CloseTs:       closeTime(next),
+		NumberOfTrade: trades,
+	}
+}
+
+func flat(p Period, open string, price float64) KLine {
+	return kline(p, open, price, price, price, price, 0, 0)
+}
+
+func TestPeriodBounds(t *testing.T) {
+	for _, c := range []struct {
+		p    Period
+		t    time.Time
+		open string
+		next string
+	}{
+		{Period1Minute, utc("2019-01-02 10:07").Add(30 * time.Second), "2019-01-02 10:07", "2019-01-02 10:08"},
+		{Period5Minutes, utc("2019-01-02 10:07"), "2019-01-02 10:05", "2019-01-02 10:10"},
+		{Period4Hours, utc("2019-01-02 10:07"), "2019-01-02 08:00", "2019-01-02 12:00"},
+		{Period1Day, utc("2019-01-02 10:07").In(time.FixedZone("UTC+14", 14*3600)), "2019-01-02 00:00", "2019-01-03 00:00"},
+		// weeks start on Monday, even across years
+		{Period1Week, utc("2019-01-02 10:07"), "2018-12-31 00:00", "2019-01-07 00:00"},
+		{Period1Week, utc("2019-01-06 23:59"), "2018-12-31 00:00", "2019-01-07 00:00"},
+		{Period1Week, utc("2019-01-07 00:00"), "2019-01-07 00:00", "2019-01-14 00:00"},
+		// months start on their first day, whatever their length
+		{Period1Month, utc("2019-01-31 23:59"), "2019-01-01 00:00", "2019-02-01 00:00"},
+		{Period1Month, utc("2019-02-15 12:00"), "2019-02-01 00:00", "2019-03-01 00:00"},
+		{Period1Month, utc("2020-02-29 12:00"), "2020-02-01 00:00", "2020-03-01 00:00"},
+		{Period1Month, utc("2018-12-01 00:00"), "2018-12-01 00:00", "2019-01-01 00:00"},
+	} {
+		open, next, err := periodBounds(c.p, c.t)
+		if err != nil || !open.Equal(utc(c.open)) || !next.Equal(utc(c.next)) {
+			t.Errorf("periodBounds(%q, %v) = %v, %v, %v, want %s, %s", string(c.p), c.t, open, next, err, c.open, c.next)
+		}
+	}
+
+	if _, _, err := periodBounds(Period("1h"), utc("2019-01-02 10:07")); err == nil {
+		t.Error("periodBounds of an unknown period succeeded")
+	}
+}
+
+func TestResampleKLines(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		p      Period
+		klines []KLine
+		want   []KLine
+	}{
+		{
+			name: "ohlc, volume and trades",
+			p:    Period5Minutes,
+			klines: []KLine{
+				kline(Period1Minute, "2019-01-02 10:01", 10, 12, 9, 11, 1, 3),
+				kline(Period1Minute, "2019-01-02 10:00", 9, 10, 8, 10, 2, 1),
+				kline(Period1Minute, "2019-01-02 10:04", 11, 11.5, 7, 8, 0.5, 4),
+			},
+			want: []KLine{
+				kline(Period5Minutes, "2019-01-02 10:00", 9, 12, 7, 8, 3.5, 8),
+			},
+		},
+		{
+			name: "several periods",
+			p:    Period5Minutes,
+			klines: []KLine{
+				kline(Period1Minute, "2019-01-02 10:04", 9, 10, 8, 10, 2, 1),
+				kline(Period1Minute, "2019-01-02 10:05", 10, 12, 9, 11, 1, 3),
+				kline(Period1Minute, "2019-01-02 10:15", 11, 11.5, 7, 8, 0.5, 4),
+			},
+			want: []KLine{
+				kline(Period5Minutes, "2019-01-02 10:00", 9, 10, 8, 10, 2, 1),
+				kline(Period5Minutes, "2019-01-02 10:05", 10, 12, 9, 11, 1, 3),
+				kline(Period5Minutes, "2019-01-02 10:15", 11, 11.5, 7, 8, 0.5, 4),
+			},
+		},
+		{
+			name: "week boundary",
+			p:    Period1Week,
+			klines: []KLine{
+				kline(Period1Day, "2019-01-05 00:00", 1, 2, 1, 2, 1, 1),
+				kline(Period1Day, "2019-01-06 00:00", 2, 3, 2, 3, 1, 1),
+				kline(Period1Day, "2019-01-07 00:00", 3, 4, 3, 4, 1, 1),
+			},
+			want: []KLine{
+				kline(Period1Week, "2018-12-31 00:00", 1, 3, 1, 3, 2, 2),
+				kline(Period1Week, "2019-01-07 00:00", 3, 4, 3, 4, 1, 1),
+			},
+		},
+		{
+			name: "month boundary",
+			p:    Period1Month,
+			klines: []KLine{
+				kline(Period1Day, "2019-01-31 00:00", 1, 2, 1, 2, 1, 1),
+				kline(Period1Day, "2019-02-01 00:00", 2, 3, 2, 3, 1, 1),
+				kline(Period1Day, "2019-02-28 00:00", 3, 4, 1.5, 4, 1, 1),
+				kline(Period1Day, "2019-03-01 00:00", 4, 5, 4, 5, 1, 1),
+			},
+			want: []KLine{
+				kline(Period1Month, "2019-01-01 00:00", 1, 2, 1, 2, 1, 1),
+				kline(Period1Month, "2019-02-01 00:00", 2, 4, 1.5, 4, 2, 2),
+				kline(Period1Month, "2019-03-01 00:00", 4, 5, 4, 5, 1, 1),
+			},
+		},
+	} {
+		got, err := ResampleKLines(c.klines, c.p)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: ResampleKLines = %+v, %v, want %+v", c.name, got, err, c.want)
+		}
+	}
+
+	if _, err := ResampleKLines([]KLine{kline(Period1Hour, "2019-01-02 10:00", 1, 1, 1, 1, 0, 0)}, Period5Minutes); err == nil {
+		t.Error("resampling into a shorter period succeeded")
+	}
+}
+
+func TestFillKLineGaps(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		p      Period
+		klines []KLine
+		want   []KLine
+	}{
+		{
+			name: "no gap",
+			p:    Period1Minute,
+			klines: []KLine{
+				kline(Period1Minute, "2019-01-02 10:00", 1, 2, 1, 2, 1, 1),
+				kline(Period1Minute, "2019-01-02 10:01", 2, 3, 2, 3, 1, 1),
+			},
+			want: []KLine{
+				kline(Period1Minute, "2019-01-02 10:00", 1, 2, 1, 2, 1, 1),
+				kline(Period1Minute, "2019-01-02 10:01", 2, 3, 2, 3, 1, 1),
+			},
+		},
+		{
+			name: "flat candles at the previous close",
+			p:    Period1Minute,
+			klines: []KLine{
+				kline(Period1Minute, "2019-01-02 10:03", 2, 3, 2, 3, 1, 1),
+				kline(Period1Minute, "2019-01-02 10:00", 1, 2, 1, 1.5, 1, 1),
+			},
+			want: []KLine{
+				kline(Period1Minute, "2019-01-02 10:00", 1, 2, 1, 1.5, 1, 1),
+				flat(Period1Minute, "2019-01-02 10:01", 1.5),
+				flat(Period1Minute, "2019-01-02 10:02", 1.5),
+				kline(Period1Minute, "2019-01-02 10:03", 2, 3, 2, 3, 1, 1),
+			},
+		},
+		{
+			name: "months",
+			p:    Period1Month,
+			klines: []KLine{
+				kline(Period1Month, "2019-01-01 00:00", 1, 2, 1, 2, 1, 1),
+				kline(Period1Month, "2019-04-01 00:00", 2, 3, 2, 3, 1, 1),
+			},
+			want: []KLine{
+				kline(Period1Month, "2019-01-01 00:00", 1, 2, 1, 2, 1, 1),
+				flat(Period1Month, "2019-02-01 00:00", 2),
+				flat(Period1Month, "2019-03-01 00:00", 2),
+				kline(Period1Month, "2019-04-01 00:00", 2, 3, 2, 3, 1, 1),
+			},
+		},
+	} {
+		got, err := FillKLineGaps(c.klines, c.p)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: FillKLineGaps = %+v, %v, want %+v", c.name, got, err, c.want)
+		}
+	}
+}
+
+func candle(open string, o, c, min, max, vol string) WSCandles {
+	d := func(s string) Decimal {
+		v, err := ParseDecimal(s)
+		if err != nil {
+			panic(err)
+		}
+		return v
+	}
+	return WSCandles{Timestamp: Timestamp{utc(open)}, Open: d(o), Close: d(c), Min: d(min), Max: d(max), Volume: d(vol)}
+}
+
+func TestKLineSeries(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		size     int
+		fillGaps bool
+		history  []KLine
+		updates  [][]WSCandles
+		want     []KLine
+	}{
+		{
+			name:    "updated last candle",
+			history: []KLine{kline(Period1Minute, "2019-01-02 10:00", 1, 2, 1, 2, 1, 3)},
+			updates: [][]WSCandles{
+				{candle("2019-01-02 10:01", "2", "2.5", "2", "2.5", "1")},
+				{candle("2019-01-02 10:01", "2", "1.5", "1", "3", "4")},
+			},
+			want: []KLine{
+				kline(Period1Minute, "2019-01-02 10:00", 1, 2, 1, 2, 1, 3),
+				kline(Period1Minute, "2019-01-02 10:01", 2, 3, 1, 1.5, 4, 0),
+			},
+		},
+		{
+			name:    "snapshot merged with the history",
+			history: []KLine{kline(Period1Minute, "2019-01-02 10:00", 1, 2, 1, 2, 1, 3)},
+			updates: [][]WSCandles{{
+				candle("2019-01-02 09:59", "1", "1", "1", "1", "1"),
+				candle("2019-01-02 10:00", "1", "2", "1", "2.5", "2"),
+			}},
+			want: []KLine{
+				kline(Period1Minute, "2019-01-02 09:59", 1, 1, 1, 1, 1, 0),
+				kline(Period1Minute, "2019-01-02 10:00", 1, 2.5, 1, 2, 2, 0),
+			},
+		},
+		{
+			name: "trimmed to capacity",
+			size: 2,
+			history: []KLine{
+				kline(Period1Minute, "2019-01-02 10:00", 1, 1, 1, 1, 1, 1),
+				kline(Period1Minute, "2019-01-02 10:01", 2, 2, 2, 2, 1, 1),
+			},
+			updates: [][]WSCandles{{candle("2019-01-02 10:02", "3", "3", "3", "3", "1")}},
+			want: []KLine{
+				kline(Period1Minute, "2019-01-02 10:01", 2, 2, 2, 2, 1, 1),
+				kline(Period1Minute, "2019-01-02 10:02", 3, 3, 3, 3, 1, 0),
+			},
+		},
+		{
+			name:     "gaps filled before trimming",
+			size:     3,
+			fillGaps: true,
+			history:  []KLine{kline(Period1Minute, "2019-01-02 10:00", 1, 1, 1, 1, 1, 1)},
+			updates:  [][]WSCandles{{candle("2019-01-02 10:04", "3", "3", "3", "3", "1")}},
+			want: []KLine{
+				flat(Period1Minute, "2019-01-02 10:02", 1),
+				flat(Period1Minute, "2019-01-02 10:03", 1),
+				kline(Period1Minute, "2019-01-02 10:04", 3, 3, 3, 3, 1, 0),
+			},
+		},
+	} {
+		s := NewKLineSeries(Period1Minute, c.size, c.fillGaps)
+		if err := s.Add(c.history...); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, u := range c.updates {
+			if err := s.MergeCandles(u...); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+		if got := s.KLines(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: klines = %+v, want %+v", c.name, got, c.want)
+		}
+		if last, ok := s.Last(); !ok || !reflect.DeepEqual(last, c.want[len(c.want)-1]) {
+			t.Errorf("%s: last = %+v, %v", c.name, last, ok)
+		}
+	}
+
+	if _, ok := NewKLineSeries(Period1Minute, 0, false).Last(); ok {
+		t.Error("empty series has a last candle")
+	}
+}
+
+func TestKLineSeriesResample(t *testing.T) {
+	s := NewKLineSeries(Period1Hour, 0, false)
+	s.Add(
+		kline(Period1Hour, "2019-01-06 23:00", 1, 2, 1, 2, 1, 1),
+		kline(Period1Hour, "2019-01-07 00:00", 2, 3, 2, 3, 1, 1),
+		kline(Period1Hour, "2019-01-07 01:00", 3, 4, 1, 2, 1, 1),
+	)
+
+	week, err := s.Resample(Period1Week)
+	want := []KLine{
+		kline(Period1Week, "2018-12-31 00:00", 1, 2, 1, 2, 1, 1),
+		kline(Period1Week, "2019-01-07 00:00", 2, 4, 1, 2, 2, 2),
+	}
+	if err != nil || !reflect.DeepEqual(week, want) {
+		t.Errorf("weekly candles = %+v, %v, want %+v", week, err, want)
+	}
+}
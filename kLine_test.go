@@ -0,0 +1,38 @@
+package spiral
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodDuration(t *testing.T) {
+	for _, c := range []struct {
+		p        Period
+		code     string
+		duration time.Duration
+	}{
+		{Period1Minute, "1", time.Minute},
+		{Period3Minutes, "3", 3 * time.Minute},
+		{Period5Minutes, "5", 5 * time.Minute},
+		{Period15Minutes, "15", 15 * time.Minute},
+		{Period30Minutes, "30", 30 * time.Minute},
+		{Period1Hour, "60", time.Hour},
+		{Period2Hours, "120", 2 * time.Hour},
+		{Period4Hours, "240", 4 * time.Hour},
+		{Period6Hours, "360", 6 * time.Hour},
+		{Period12Hours, "720", 12 * time.Hour},
+		{Period1Day, "1440", 24 * time.Hour},
+		{Period1Week, "10080", 7 * 24 * time.Hour},
+		{Period1Month, "43200", 30 * 24 * time.Hour},
+		{Period(""), "", 0},
+		{Period("0"), "0", 0},
+		{Period("1h"), "1h", 0},
+	} {
+		if string(c.p) != c.code {
+			t.Errorf("period %q has code %q, want %q", string(c.p), string(c.p), c.code)
+		}
+		if d := c.p.Duration(); d != c.duration {
+			t.Errorf("Period(%q).Duration() = %v, want %v", string(c.p), d, c.duration)
+		}
+	}
+}
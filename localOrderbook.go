@@ -0,0 +1,337 @@
+package spiral
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// ErrLocalOrderBookClosed is the Err of a LocalOrderBook closed by Close.
+var ErrLocalOrderBookClosed = errors.New("Spiral LocalOrderBook closed")
+
+// OrderbookSubscriber opens order book subscriptions, like WSClient and WSPool.
+type OrderbookSubscriber interface {
+	SubscribeOrderbook(symbol string, opts ...FeedOptions) (*OrderbookSubscription, error)
+}
+
+var (
+	_ OrderbookSubscriber = (*WSClient)(nil)
+	_ OrderbookSubscriber = (*WSPool)(nil)
+)
+
+// LocalOrderBook is an order book maintained from the WebSocket orderbook feed.
+//
+// The book is rebuilt from every snapshot and updates are applied in sequence,
+// a level of size 0 removing the price. Levels are identified by their exact
+// decimal price. When an update is missing the book stops being synced and a
+// fresh snapshot is requested. All methods are safe for concurrent use.
+type LocalOrderBook struct {
+	symbol       string
+	subscription *OrderbookSubscription
+
+	mu        sync.RWMutex
+	bids      bookSide
+	asks      bookSide
+	sequence  int64
+	synced    bool
+	resyncing bool
+	err       error
+
+	changes   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLocalOrderBook subscribes to the order book of symbol through client, a
+// WSClient or a WSPool, and keeps a local copy of it. The subscription is
+// shared with the other handles of the feed.
+func NewLocalOrderBook(client OrderbookSubscriber, symbol string) (*LocalOrderBook, error) {
+	subscription, err := client.SubscribeOrderbook(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &LocalOrderBook{
+		symbol:       symbol,
+		subscription: subscription,
+		bids:         bookSide{descending: true},
+		changes:      make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	go b.run(subscription.Updates, subscription.Snapshots)
+	return b, nil
+}
+
+// run applies the feed until it ends or the book is closed, then closes
+// Changes.
+func (b *LocalOrderBook) run(updates <-chan WSNotificationOrderbookUpdate, snapshots <-chan WSNotificationOrderbookSnapshot) {
+	defer close(b.changes)
+	for {
+		select {
+		case snapshot, ok := <-snapshots:
+			if !ok {
+				b.stop(b.ended())
+				return
+			}
+			b.applySnapshot(snapshot)
+		case update, ok := <-updates:
+			if !ok {
+				b.stop(b.ended())
+				return
+			}
+			b.applyUpdate(update)
+		case <-b.done:
+			b.stop(ErrLocalOrderBookClosed)
+			return
+		}
+	}
+}
+
+// ended returns why the feed ended: Close closes the book before its
+// subscription, anything else closed the connection.
+func (b *LocalOrderBook) ended() error {
+	select {
+	case <-b.done:
+		return ErrLocalOrderBookClosed
+	default:
+		return errors.Errorf("Spiral LocalOrderBook %s: feed closed", b.symbol)
+	}
+}
+
+// stop marks the book out of sync for good.
+func (b *LocalOrderBook) stop(err error) {
+	b.mu.Lock()
+	b.synced = false
+	b.err = err
+	b.mu.Unlock()
+}
+
+func (b *LocalOrderBook) applySnapshot(snapshot WSNotificationOrderbookSnapshot) {
+	b.mu.Lock()
+	b.bids.reset(snapshot.Bid)
+	b.asks.reset(snapshot.Ask)
+	b.sequence = snapshot.Sequence
+	b.synced = true
+	b.resyncing = false
+	b.err = nil
+	b.mu.Unlock()
+
+	b.notify()
+}
+
+func (b *LocalOrderBook) applyUpdate(update WSNotificationOrderbookUpdate) {
+	b.mu.Lock()
+	switch {
+	case !b.synced:
+		b.mu.Unlock()
+		b.resync()
+		return
+	case update.Sequence <= b.sequence:
+		b.mu.Unlock() // already part of the book
+		return
+	case update.Sequence != b.sequence+1:
+		err := errors.Errorf("orderbook %s sequence gap: expected %d, got %d", b.symbol, b.sequence+1, update.Sequence)
+		b.mu.Unlock()
+		b.fail(err)
+		return
+	}
+
+	b.bids.apply(update.Bid)
+	b.asks.apply(update.Ask)
+	b.sequence = update.Sequence
+	b.mu.Unlock()
+
+	b.notify()
+}
+
+// fail marks the book out of sync and requests a fresh snapshot.
+func (b *LocalOrderBook) fail(err error) {
+	b.mu.Lock()
+	b.synced = false
+	b.err = err
+	b.mu.Unlock()
+
+	b.resync()
+}
+
+// resync asks the connection carrying the feed for a new snapshot.
+func (b *LocalOrderBook) resync() {
+	b.mu.Lock()
+	if b.resyncing {
+		b.mu.Unlock()
+		return
+	}
+	b.resyncing = true
+	b.mu.Unlock()
+
+	go func() {
+		err := b.subscription.Resync()
+		if err != nil {
+			b.mu.Lock()
+			b.resyncing = false // retried on the next update
+			b.err = errors.Annotate(err, "Spiral LocalOrderBook resync")
+			b.mu.Unlock()
+		}
+	}()
+}
+
+func (b *LocalOrderBook) notify() {
+	select {
+	case b.changes <- struct{}{}:
+	default:
+	}
+}
+
+// bookLevel is a price level keyed by its exact price.
+type bookLevel struct {
+	price *big.Rat
+	item  OrderBookItem
+}
+
+// bookSide holds the levels of one side of the book sorted best first.
+type bookSide struct {
+	levels     []bookLevel
+	descending bool
+}
+
+// search returns the position of price in the side, and whether it is there.
+func (s *bookSide) search(price *big.Rat) (int, bool) {
+	i := sort.Search(len(s.levels), func(i int) bool {
+		c := s.levels[i].price.Cmp(price)
+		if s.descending {
+			return c <= 0
+		}
+		return c >= 0
+	})
+	return i, i < len(s.levels) && s.levels[i].price.Cmp(price) == 0
+}
+
+// reset replaces the side with the levels of a snapshot.
+func (s *bookSide) reset(items []WSSubtypeTrade) {
+	s.levels = s.levels[:0]
+	s.apply(items)
+}
+
+// apply sets the size of each level, removing the levels of size 0.
+func (s *bookSide) apply(items []WSSubtypeTrade) {
+	for _, item := range items {
+		price := item.Price.Rat()
+		i, found := s.search(price)
+		switch {
+		case item.Size.IsZero():
+			if found {
+				s.levels = append(s.levels[:i], s.levels[i+1:]...)
+			}
+		case found:
+			s.levels[i].item.Size = item.Size.Float64()
+		default:
+			s.levels = append(s.levels, bookLevel{})
+			copy(s.levels[i+1:], s.levels[i:])
+			s.levels[i] = bookLevel{price: price, item: OrderBookItem{Price: item.Price.Float64(), Size: item.Size.Float64()}}
+		}
+	}
+}
+
+// best returns the best level of the side.
+func (s *bookSide) best() (OrderBookItem, bool) {
+	if len(s.levels) == 0 {
+		return OrderBookItem{}, false
+	}
+	return s.levels[0].item, true
+}
+
+// top returns at most n levels best first, all of them when n is not positive.
+func (s *bookSide) top(n int) []OrderBookItem {
+	if n <= 0 || n > len(s.levels) {
+		n = len(s.levels)
+	}
+	items := make([]OrderBookItem, n)
+	for i := range items {
+		items[i] = s.levels[i].item
+	}
+	return items
+}
+
+// Symbol returns the market of the book.
+func (b *LocalOrderBook) Symbol() string {
+	return b.symbol
+}
+
+// BestBid returns the highest bid, false if there is none or the book is not synced.
+func (b *LocalOrderBook) BestBid() (OrderBookItem, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.synced {
+		return OrderBookItem{}, false
+	}
+	return b.bids.best()
+}
+
+// BestAsk returns the lowest ask, false if there is none or the book is not synced.
+func (b *LocalOrderBook) BestAsk() (OrderBookItem, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.synced {
+		return OrderBookItem{}, false
+	}
+	return b.asks.best()
+}
+
+// Depth returns the n best levels of each side, the best price first like GetOrderbook.
+// All levels are returned when n is not positive. The book is empty and false
+// is returned when the book is not synced.
+func (b *LocalOrderBook) Depth(n int) (Orderbook, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.synced {
+		return Orderbook{}, false
+	}
+	return Orderbook{
+		Ask: b.asks.top(n),
+		Bid: b.bids.top(n),
+	}, true
+}
+
+// Sequence returns the sequence of the last snapshot or update applied.
+func (b *LocalOrderBook) Sequence() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.sequence
+}
+
+// Synced reports whether the book reflects the server one, that is a snapshot
+// was received and no update was missed since.
+func (b *LocalOrderBook) Synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.synced
+}
+
+// Err returns the reason the book last went out of sync, nil once resynced.
+// Once Changes is closed it returns why the book stopped:
+// ErrLocalOrderBookClosed after Close, an error of the feed when the
+// connection was closed.
+func (b *LocalOrderBook) Err() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.err
+}
+
+// Changes returns a channel signalled after the book changed. Signals are
+// coalesced, readers should query the book rather than count them. The
+// channel is closed once the book stops being maintained, see Err.
+func (b *LocalOrderBook) Changes() <-chan struct{} {
+	return b.changes
+}
+
+// Close stops maintaining the book and closes its order book subscription.
+func (b *LocalOrderBook) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.done)
+		err = b.subscription.Close()
+	})
+	return err
+}
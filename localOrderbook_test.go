@@ -0,0 +1,182 @@
+package spiral
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func levels(pairs ...string) []map[string]string {
+	var items []map[string]string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		items = append(items, map[string]string{"price": pairs[i], "size": pairs[i+1]})
+	}
+	return items
+}
+
+func orderbookParams(sequence int64, bid, ask []map[string]string) map[string]interface{} {
+	return map[string]interface{}{"symbol": "ETHBTC", "sequence": sequence, "bid": bid, "ask": ask}
+}
+
+func waitChange(t *testing.T, b *LocalOrderBook, sequence int64) {
+	t.Helper()
+	eventually(t, "sequence", func() bool { return b.Synced() && b.Sequence() == sequence })
+}
+
+func TestLocalOrderBook(t *testing.T) {
+	server := newRPCServer(t)
+	client, err := NewWSClientWithConfig(WSConfig{URL: server.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	b, err := NewLocalOrderBook(client, "ETHBTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if b.Synced() {
+		t.Error("book synced before its snapshot")
+	}
+	if depth, ok := b.Depth(0); ok || len(depth.Bid) != 0 || len(depth.Ask) != 0 {
+		t.Errorf("depth before the snapshot = %+v, %v", depth, ok)
+	}
+
+	server.notify("snapshotOrderbook", "subscribeOrderbook", orderbookParams(10,
+		levels("0.030", "1", "0.032", "2", "0.031", "3"),
+		levels("0.034", "4", "0.033", "5")))
+	waitChange(t, b, 10)
+
+	if bid, ok := b.BestBid(); !ok || bid.Price != 0.032 || bid.Size != 2 {
+		t.Errorf("best bid = %+v, %v", bid, ok)
+	}
+	if ask, ok := b.BestAsk(); !ok || ask.Price != 0.033 || ask.Size != 5 {
+		t.Errorf("best ask = %+v, %v", ask, ok)
+	}
+
+	// 0.0320 is the 0.032 level, 0.03 the 0.030 one
+	server.notify("updateOrderbook", "subscribeOrderbook", orderbookParams(11,
+		levels("0.0320", "0", "0.03", "7", "0.0315", "1"),
+		levels("0.0330", "6")))
+	waitChange(t, b, 11)
+
+	depth, ok := b.Depth(0)
+	if !ok {
+		t.Fatal("depth of a synced book not returned")
+	}
+	wantBid := []OrderBookItem{{0.0315, 1}, {0.031, 3}, {0.03, 7}}
+	wantAsk := []OrderBookItem{{0.033, 6}, {0.034, 4}}
+	if len(depth.Bid) != len(wantBid) || len(depth.Ask) != len(wantAsk) {
+		t.Fatalf("depth = %+v", depth)
+	}
+	for i := range wantBid {
+		if depth.Bid[i] != wantBid[i] {
+			t.Errorf("bid %d = %+v, want %+v", i, depth.Bid[i], wantBid[i])
+		}
+	}
+	for i := range wantAsk {
+		if depth.Ask[i] != wantAsk[i] {
+			t.Errorf("ask %d = %+v, want %+v", i, depth.Ask[i], wantAsk[i])
+		}
+	}
+	if top, _ := b.Depth(1); len(top.Bid) != 1 || len(top.Ask) != 1 {
+		t.Errorf("Depth(1) = %+v", top)
+	}
+}
+
+func TestLocalOrderBookResync(t *testing.T) {
+	server := newRPCServer(t)
+	pool, err := NewWSPool(WSPoolConfig{WSConfig: WSConfig{URL: server.url()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// a second handle shares the feed of the book
+	other, err := pool.SubscribeOrderbook("ETHBTC", FeedOptions{Buffer: 16, Policy: DropOldestPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	b, err := NewLocalOrderBook(pool, "ETHBTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if n := server.count("subscribeOrderbook"); n != 1 {
+		t.Fatalf("%d subscribeOrderbook calls, want 1", n)
+	}
+
+	server.notify("snapshotOrderbook", "subscribeOrderbook", orderbookParams(1, levels("1", "1"), levels("2", "1")))
+	waitChange(t, b, 1)
+
+	server.notify("updateOrderbook", "subscribeOrderbook", orderbookParams(3, levels("1", "2"), nil))
+	eventually(t, "resync", func() bool { return server.count("subscribeOrderbook") == 2 })
+	if b.Synced() || b.Err() == nil || !strings.Contains(b.Err().Error(), "sequence gap") {
+		t.Errorf("after a gap synced = %v, err = %v", b.Synced(), b.Err())
+	}
+	if _, ok := b.BestBid(); ok {
+		t.Error("best bid of an out of sync book")
+	}
+	if depth, ok := b.Depth(0); ok || len(depth.Bid) != 0 {
+		t.Errorf("depth of an out of sync book = %+v", depth)
+	}
+
+	server.notify("snapshotOrderbook", "subscribeOrderbook", orderbookParams(5, levels("1", "3"), levels("2", "1")))
+	waitChange(t, b, 5)
+	if bid, _ := b.BestBid(); bid.Size != 3 || b.Err() != nil {
+		t.Errorf("resynced best bid = %+v, err = %v", bid, b.Err())
+	}
+	if depth, ok := b.Depth(0); !ok || len(depth.Bid) != 1 || len(depth.Ask) != 1 {
+		t.Errorf("resynced depth = %+v, %v", depth, ok)
+	}
+}
+
+func TestLocalOrderBookEnd(t *testing.T) {
+	server := newRPCServer(t)
+	client, err := NewWSClientWithConfig(WSConfig{URL: server.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	closed, err := NewLocalOrderBook(client, "ETHBTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended, err := NewLocalOrderBook(client, "ETHBTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed.Close()
+	waitClosed(t, closed.Changes())
+	if closed.Err() != ErrLocalOrderBookClosed {
+		t.Errorf("Err after Close = %v", closed.Err())
+	}
+	if err := closed.subscription.Resync(); err != ErrSubscriptionClosed {
+		t.Errorf("Resync after Close = %v", err)
+	}
+
+	client.Close()
+	waitClosed(t, ended.Changes())
+	if err := ended.Err(); err == nil || !strings.Contains(err.Error(), "feed closed") {
+		t.Errorf("Err after the client closed = %v", err)
+	}
+}
+
+func waitClosed(t *testing.T, changes <-chan struct{}) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Changes not closed")
+		}
+	}
+}
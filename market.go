@@ -0,0 +1,179 @@
+package spiral
+
+import (
+	"sort"
+	"time"
+)
+
+// Book is an order book, whether fetched by REST or received over WebSocket.
+type Book struct {
+	Symbol   string
+	Sequence int64           // 0 when the source has none
+	Delta    bool            // levels change a previous book, a size of 0 removing the price
+	Bid      []OrderBookItem // best first
+	Ask      []OrderBookItem // best first
+}
+
+// Candle is a kline, whether fetched by REST or received over WebSocket.
+type Candle struct {
+	Symbol      string
+	Period      Period
+	OpenTime    time.Time
+	CloseTime   time.Time
+	Open        float64
+	High        float64
+	Low         float64
+	Close       float64
+	Volume      float64 // in base currency
+	QuoteVolume float64 // in quote currency, 0 when the source does not send it
+	Trades      int64   // 0 when the source does not send it
+}
+
+// MarketTrade is a trade, whether fetched by REST or received over WebSocket.
+type MarketTrade struct {
+	ID       int64
+	Symbol   string
+	Side     side
+	Price    float64
+	Quantity float64
+	Fee      float64 // only sent for your own trades
+	Time     time.Time
+}
+
+// parseSide returns the side of s, translating the buy and sell sides of
+// the WebSocket API.
+func parseSide(s string) side {
+	if sd, ok := wsSide[s]; ok {
+		return sd
+	}
+	return side(s)
+}
+
+func newBook(symbol string, sequence int64, delta bool, bid, ask []OrderBookItem) Book {
+	b := Book{Symbol: symbol, Sequence: sequence, Delta: delta, Bid: bid, Ask: ask}
+	sort.SliceStable(b.Bid, func(i, j int) bool { return b.Bid[i].Price > b.Bid[j].Price })
+	sort.SliceStable(b.Ask, func(i, j int) bool { return b.Ask[i].Price < b.Ask[j].Price })
+	return b
+}
+
+// Book converts the order book of symbol fetched by GetOrderbook.
+func (o Orderbook) Book(symbol string) Book {
+	bid := append([]OrderBookItem(nil), o.Bid...)
+	ask := append([]OrderBookItem(nil), o.Ask...)
+	return newBook(symbol, 0, false, bid, ask)
+}
+
+// Book converts an order book snapshot.
+func (s WSNotificationOrderbookSnapshot) Book() Book {
+	return newBook(s.Symbol, s.Sequence, false, parseLevels(s.Bid), parseLevels(s.Ask))
+}
+
+// Book converts an order book update, which is a delta.
+func (u WSNotificationOrderbookUpdate) Book() Book {
+	return newBook(u.Symbol, u.Sequence, true, parseLevels(u.Bid), parseLevels(u.Ask))
+}
+
+func parseLevels(items []WSSubtypeTrade) []OrderBookItem {
+	levels := make([]OrderBookItem, len(items))
+	for i, item := range items {
+		levels[i] = OrderBookItem{Price: item.Price.Float64(), Size: item.Size.Float64()}
+	}
+	return levels
+}
+
+// Candle converts a kline of symbol fetched with period p.
+func (k KLine) Candle(symbol string, p Period) Candle {
+	return Candle{
+		Symbol:    symbol,
+		Period:    p,
+		OpenTime:  k.OpenTs.Time,
+		CloseTime: k.CloseTs.Time,
+		Open:      k.Open,
+		High:      k.High,
+		Low:       k.Low,
+		Close:     k.Close,
+		Volume:    k.Vol,
+		Trades:    k.NumberOfTrade,
+	}
+}
+
+// Candle converts a WebSocket candle of symbol and period p.
+func (c WSCandles) Candle(symbol string, p Period) (Candle, error) {
+	k, err := c.KLine(p)
+	if err != nil {
+		return Candle{}, err
+	}
+	candle := k.Candle(symbol, p)
+	candle.QuoteVolume = c.VolumeQuote.Float64()
+	return candle, nil
+}
+
+// Candles converts the candles of a snapshot.
+func (s WSNotificationCandlesSnapshot) Candles() ([]Candle, error) {
+	return wsCandles(s.Symbol, s.Period, s.Data)
+}
+
+// Candles converts the candles of an update.
+func (u WSNotificationCandlesUpdate) Candles() ([]Candle, error) {
+	return wsCandles(u.Symbol, u.Period, []WSCandles{u.Data})
+}
+
+func wsCandles(symbol string, timeframe interval, data []WSCandles) ([]Candle, error) {
+	candles := make([]Candle, len(data))
+	for i, c := range data {
+		candle, err := c.Candle(symbol, timeframe.Period())
+		if err != nil {
+			return nil, err
+		}
+		candles[i] = candle
+	}
+	return candles, nil
+}
+
+// MarketTrade converts a trade fetched by GetTrades.
+func (t Trade) MarketTrade() MarketTrade {
+	return MarketTrade{
+		ID:       t.ID,
+		Symbol:   t.Symbol,
+		Side:     parseSide(t.Side),
+		Price:    t.Price,
+		Quantity: t.Quantity,
+		Fee:      t.Fee,
+		Time:     t.Timestamp.Time,
+	}
+}
+
+// MarketTrade converts a WebSocket trade of symbol.
+func (t WSTrades) MarketTrade(symbol string) MarketTrade {
+	return MarketTrade{
+		ID:       int64(t.ID),
+		Symbol:   symbol,
+		Side:     parseSide(t.Side),
+		Price:    t.Price.Float64(),
+		Quantity: t.Quantity.Float64(),
+		Time:     t.Timestamp.Time,
+	}
+}
+
+// MarketTrades converts the trades of a snapshot.
+func (s WSNotificationTradesSnapshot) MarketTrades() []MarketTrade {
+	return wsMarketTrades(s.Symbol, s.Data)
+}
+
+// MarketTrades converts the trades of an update.
+func (u WSNotificationTradesUpdate) MarketTrades() []MarketTrade {
+	return wsMarketTrades(u.Symbol, []WSTrades{u.Data})
+}
+
+// MarketTrades converts the trades of a GetTrades response.
+func (r WSGetTradesResponse) MarketTrades() []MarketTrade {
+	return wsMarketTrades(r.Symbol, r.Data)
+}
+
+func wsMarketTrades(symbol string, data []WSTrades) []MarketTrade {
+	trades := make([]MarketTrade, len(data))
+	for i, t := range data {
+		trades[i] = t.MarketTrade(symbol)
+	}
+	return trades
+}
@@ -1,13 +1,21 @@
 package spiral
 
-type orderGetRequest struct {
-	Symbol    string `json:"symbol"`
-	Side      side   `json:"side"`
-	Filter    string `json:"filter"`
-	Count     int    `json:"count"`
-	Reverse   bool   `json:"reverse"`
-	StartTime int64  `json:"start_time"`
-	EndTime   int64  `json:"end_time"`
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderGetRequest filters the order history. Zero StartTime or EndTime leave the range open.
+type OrderGetRequest struct {
+	Symbol    string    `json:"symbol"`
+	Side      side      `json:"side"`
+	Filter    string    `json:"filter"`
+	Count     int       `json:"count"`
+	Reverse   bool      `json:"reverse"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
 }
 
 type Orders struct {
@@ -21,8 +29,8 @@ type Orders struct {
 	FilledQuantity float64     `json:"filled_quantity,string"`
 	Type           orderType   `json:"type"`
 	Status         orderStatus `json:"status"`
-	CreateTime     int64       `json:"create_time"`
-	UpdateTime     int64       `json:"update_time"`
+	CreateTime     Timestamp   `json:"create_time"`
+	UpdateTime     Timestamp   `json:"update_time"`
 }
 
 type OrdersReturn struct {
@@ -45,6 +53,25 @@ type PlaceData struct {
 	Quantity      float64     `json:"quantity,string"`
 	Type          orderType   `json:"type"`
 	Status        orderStatus `json:"status"`
-	CreateTime    int64       `json:"create_time"`
-	UpdateTime    int64       `json:"update_time"`
+	CreateTime    Timestamp   `json:"create_time"`
+	UpdateTime    Timestamp   `json:"update_time"`
+}
+
+// FormatAmount formats a quantity or a price for an order request. It is
+// rounded to 15 significant digits, the precision of a float64, so sums such
+// as 0.1+0.2 are sent as 0.3, but never to less than 8 decimals. Trailing
+// zeros are dropped.
+func FormatAmount(f float64) string {
+	integer := len(strconv.FormatFloat(math.Trunc(math.Abs(f)), 'f', 0, 64))
+	decimals := 15 - integer
+	if decimals < 8 {
+		decimals = 8
+	}
+	s := strconv.FormatFloat(f, 'f', decimals, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		s = "0"
+	}
+	return s
 }
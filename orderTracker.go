@@ -0,0 +1,346 @@
+package spiral
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrOrderNotTracked is returned when an update concerns an order the
+// OrderTracker does not track.
+var ErrOrderNotTracked = errors.New("spiral: order not tracked")
+
+// orderTransitions lists the statuses each status may be followed by. Polling
+// may miss intermediate statuses, so later statuses of the lifecycle are
+// allowed directly. Filled, Cancelled and Rejected are terminal.
+var orderTransitions = map[orderStatus][]orderStatus{
+	Submitted:       {Accepted, Waiting, Rejected, PartialFilled, Filled, CancelRequested, Cancelled},
+	Waiting:         {Accepted, Rejected, PartialFilled, Filled, CancelRequested, Cancelled},
+	Accepted:        {PartialFilled, Filled, CancelRequested, Cancelled, ModifyRequested},
+	PartialFilled:   {PartialFilled, Filled, CancelRequested, Cancelled, ModifyRequested},
+	CancelRequested: {CancelRejected, Cancelled, PartialFilled, Filled},
+	CancelRejected:  {Accepted, PartialFilled, Filled, CancelRequested, Cancelled, ModifyRequested},
+	ModifyRequested: {Modified, ModifyRejected, PartialFilled, Filled, CancelRequested, Cancelled},
+	ModifyRejected:  {Accepted, PartialFilled, Filled, CancelRequested, Cancelled, ModifyRequested},
+	Modified:        {Accepted, PartialFilled, Filled, CancelRequested, Cancelled, ModifyRequested},
+	Filled:          {},
+	Cancelled:       {},
+	Rejected:        {},
+}
+
+// Terminal reports whether s is a final order status.
+func (s orderStatus) Terminal() bool {
+	next, known := orderTransitions[s]
+	return known && len(next) == 0
+}
+
+// canFollow reports whether an order of status s may next be reported as
+// next. An unknown status is accepted anywhere but after a terminal status.
+func (s orderStatus) canFollow(next orderStatus) bool {
+	if s == Unknown || next == Unknown {
+		return !s.Terminal()
+	}
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned when an update moves an order to a status that
+// cannot follow its current one, or decreases its filled quantity.
+type TransitionError struct {
+	ClientOrderId string
+	From          orderStatus
+	To            orderStatus
+	Filled        float64 // filled quantity before the update
+	Reported      float64 // filled quantity of the update
+}
+
+func (e *TransitionError) Error() string {
+	if e.Reported < e.Filled {
+		return fmt.Sprintf("spiral: order %s filled quantity %v reported as %v (%s)", e.ClientOrderId, e.Filled, e.Reported, e.To)
+	}
+	return fmt.Sprintf("spiral: order %s cannot move from %s to %s", e.ClientOrderId, e.From, e.To)
+}
+
+type orderEventType int
+
+const (
+	// OrderStatusEvent is emitted when the status of an order changes.
+	OrderStatusEvent orderEventType = iota
+	// OrderFillEvent is emitted when the filled quantity of an order increases.
+	OrderFillEvent
+	// OrderDoneEvent is emitted once an order reaches a terminal status.
+	OrderDoneEvent
+	// OrderInvalidEvent is emitted when an update is rejected as an impossible transition.
+	OrderInvalidEvent
+)
+
+func (t orderEventType) String() string {
+	switch t {
+	case OrderStatusEvent:
+		return "status"
+	case OrderFillEvent:
+		return "fill"
+	case OrderDoneEvent:
+		return "done"
+	case OrderInvalidEvent:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// OrderEvent notifies a change of a tracked order.
+type OrderEvent struct {
+	Type     orderEventType
+	Order    Orders      // state of the order after the update, before it for OrderInvalidEvent
+	Previous orderStatus // status before the update
+	Fill     float64     // quantity filled by the update, for OrderFillEvent
+	Err      error       // the TransitionError of OrderInvalidEvent
+	Time     time.Time
+}
+
+// OrderTracker follows the lifecycle of the orders you place, identified by
+// their client order id.
+//
+// Updates may come from GetOrderByClientID, GetOpenOrders or the order reports of the
+// WebSocket API, in any mix. Each update is checked against the order status
+// state machine: impossible transitions are rejected and reported, other
+// updates are applied and emitted as events, in the order the updates were
+// applied.
+type OrderTracker struct {
+	mu      sync.Mutex
+	orders  map[string]*Orders
+	events  chan OrderEvent
+	dropped uint64 // events discarded while the channel was full
+}
+
+// NewOrderTracker returns a tracker emitting its events on a channel of
+// buffer events. Updates never block: events emitted while the channel is
+// full are discarded and counted by Dropped, the state of the orders being
+// updated all the same.
+func NewOrderTracker(buffer int) *OrderTracker {
+	return &OrderTracker{
+		orders: make(map[string]*Orders),
+		events: make(chan OrderEvent, buffer),
+	}
+}
+
+// Events returns the channel notifying the changes of the tracked orders.
+func (t *OrderTracker) Events() <-chan OrderEvent {
+	return t.events
+}
+
+// Dropped returns the number of events discarded because the channel of
+// Events was full.
+func (t *OrderTracker) Dropped() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Track starts tracking order, which must have a client order id. Its status
+// defaults to Submitted.
+func (t *OrderTracker) Track(order Orders) error {
+	if order.ClientOrderId == "" {
+		return errors.New("spiral: cannot track an order without client order id")
+	}
+	if order.Status == "" {
+		order.Status = Submitted
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.orders[order.ClientOrderId]; ok {
+		return fmt.Errorf("spiral: order %s already tracked", order.ClientOrderId)
+	}
+	t.orders[order.ClientOrderId] = &order
+	return nil
+}
+
+// Forget stops tracking the order clientOrderId.
+func (t *OrderTracker) Forget(clientOrderId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.orders, clientOrderId)
+}
+
+// Order returns the current state of the order clientOrderId.
+func (t *OrderTracker) Order(clientOrderId string) (Orders, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, ok := t.orders[clientOrderId]
+	if !ok {
+		return Orders{}, false
+	}
+	return *o, true
+}
+
+// Orders returns the tracked orders, open ones only if open is set.
+func (t *OrderTracker) Orders(open bool) []Orders {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	orders := make([]Orders, 0, len(t.orders))
+	for _, o := range t.orders {
+		if !open || !o.Status.Terminal() {
+			orders = append(orders, *o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ClientOrderId < orders[j].ClientOrderId })
+	return orders
+}
+
+// Apply updates the tracked order having the client order id of update. It
+// returns ErrOrderNotTracked for other orders and a TransitionError, also
+// emitted as OrderInvalidEvent, when the update is impossible. Updates
+// without status only change the filled quantity.
+func (t *OrderTracker) Apply(update Orders) error {
+	t.mu.Lock()
+	o, ok := t.orders[update.ClientOrderId]
+	if !ok {
+		t.mu.Unlock()
+		return ErrOrderNotTracked
+	}
+	events, err := t.apply(o, update)
+	t.emit(events) // under the lock, so events keep the order of the updates
+	t.mu.Unlock()
+	return err
+}
+
+// emit sends events without blocking, counting the ones the channel has no
+// room for. t.mu must be held.
+func (t *OrderTracker) emit(events []OrderEvent) {
+	for _, ev := range events {
+		select {
+		case t.events <- ev:
+		default:
+			t.dropped++
+		}
+	}
+}
+
+// ApplyReport applies an order report of the WebSocket API.
+func (t *OrderTracker) ApplyReport(report WSOrderReport) error {
+	return t.Apply(report.Order())
+}
+
+// apply checks update against o and merges it, returning the events to emit.
+func (t *OrderTracker) apply(o *Orders, update Orders) ([]OrderEvent, error) {
+	now := time.Now()
+	previous := o.Status
+	next := update.Status
+	if next == "" {
+		next = previous
+	}
+
+	if update.FilledQuantity < o.FilledQuantity || (next != previous && !previous.canFollow(next)) {
+		err := &TransitionError{
+			ClientOrderId: o.ClientOrderId,
+			From:          previous,
+			To:            next,
+			Filled:        o.FilledQuantity,
+			Reported:      update.FilledQuantity,
+		}
+		return []OrderEvent{{Type: OrderInvalidEvent, Order: *o, Previous: previous, Err: err, Time: now}}, err
+	}
+
+	fill := update.FilledQuantity - o.FilledQuantity
+	if update.Id != 0 {
+		o.Id = update.Id
+	}
+	if update.Price != 0 {
+		o.Price = update.Price
+	}
+	if update.Quantity != 0 {
+		o.Quantity = update.Quantity
+	}
+	if update.FilledPrice != 0 {
+		o.FilledPrice = update.FilledPrice
+	}
+	if !update.UpdateTime.IsZero() {
+		o.UpdateTime = update.UpdateTime
+	}
+	if o.CreateTime.IsZero() {
+		o.CreateTime = update.CreateTime
+	}
+	o.FilledQuantity = update.FilledQuantity
+	o.Status = next
+
+	var events []OrderEvent
+	if fill > 0 {
+		events = append(events, OrderEvent{Type: OrderFillEvent, Order: *o, Previous: previous, Fill: fill, Time: now})
+	}
+	if next != previous {
+		events = append(events, OrderEvent{Type: OrderStatusEvent, Order: *o, Previous: previous, Time: now})
+		if next.Terminal() {
+			events = append(events, OrderEvent{Type: OrderDoneEvent, Order: *o, Previous: previous, Time: now})
+		}
+	}
+	return events, nil
+}
+
+// Poll fetches every open tracked order with GetOrderByClientID and applies
+// it. The first error is returned once every order was polled.
+func (t *OrderTracker) Poll(api Trading) error {
+	var first error
+	for _, o := range t.Orders(true) {
+		order, err := api.GetOrderByClientID(o.ClientOrderId)
+		if err == nil {
+			err = t.Apply(order)
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ApplyOpenOrders applies the orders returned by GetOpenOrders, ignoring the
+// untracked ones.
+func (t *OrderTracker) ApplyOpenOrders(orders []Orders) error {
+	var first error
+	for _, o := range orders {
+		if err := t.Apply(o); err != nil && err != ErrOrderNotTracked && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Follow applies the reports and active order snapshots of sub until its
+// channels are closed. The first error, reports of untracked orders aside, is
+// returned then; errors are emitted as OrderInvalidEvent as well.
+func (t *OrderTracker) Follow(sub *ReportsSubscription) error {
+	var first error
+	apply := func(r WSOrderReport) {
+		if err := t.ApplyReport(r); err != nil && err != ErrOrderNotTracked && first == nil {
+			first = err
+		}
+	}
+
+	updates, snapshots := sub.Updates, sub.Snapshots
+	for updates != nil || snapshots != nil {
+		select {
+		case r, ok := <-updates:
+			if !ok {
+				updates = nil
+				continue
+			}
+			apply(r)
+		case reports, ok := <-snapshots:
+			if !ok {
+				snapshots = nil
+				continue
+			}
+			for _, r := range reports {
+				apply(r)
+			}
+		}
+	}
+	return first
+}
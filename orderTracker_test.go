@@ -0,0 +1,173 @@
+package spiral
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// eventTypes returns the types of the events waiting on the tracker channel.
+func eventTypes(t *OrderTracker) []orderEventType {
+	var types []orderEventType
+	for {
+		select {
+		case ev := <-t.Events():
+			types = append(types, ev.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func sameTypes(got, want []orderEventType) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOrderTracker(t *testing.T) {
+	tracker := NewOrderTracker(16)
+	if err := tracker.Track(Orders{ClientOrderId: "a", Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Track(Orders{ClientOrderId: "a"}); err == nil {
+		t.Error("tracking an order twice succeeded")
+	}
+	if err := tracker.Apply(Orders{ClientOrderId: "b", Status: Accepted}); err != ErrOrderNotTracked {
+		t.Errorf("Apply of an untracked order = %v", err)
+	}
+
+	for _, c := range []struct {
+		update Orders
+		want   []orderEventType
+	}{
+		{Orders{ClientOrderId: "a", Status: Accepted, Id: 7}, []orderEventType{OrderStatusEvent}},
+		{Orders{ClientOrderId: "a", Status: PartialFilled, FilledQuantity: 0.5}, []orderEventType{OrderFillEvent, OrderStatusEvent}},
+		{Orders{ClientOrderId: "a", FilledQuantity: 1}, []orderEventType{OrderFillEvent}},
+		{Orders{ClientOrderId: "a", Status: Filled, FilledQuantity: 2}, []orderEventType{OrderFillEvent, OrderStatusEvent, OrderDoneEvent}},
+	} {
+		if err := tracker.Apply(c.update); err != nil {
+			t.Fatalf("Apply(%+v) = %v", c.update, err)
+		}
+		if got := eventTypes(tracker); !sameTypes(got, c.want) {
+			t.Errorf("Apply(%+v) events = %v, want %v", c.update, got, c.want)
+		}
+	}
+
+	o, _ := tracker.Order("a")
+	if o.Id != 7 || o.Status != Filled || o.FilledQuantity != 2 {
+		t.Errorf("order = %+v", o)
+	}
+	if open := tracker.Orders(true); len(open) != 0 {
+		t.Errorf("open orders = %+v", open)
+	}
+}
+
+func TestOrderTrackerInvalidTransition(t *testing.T) {
+	tracker := NewOrderTracker(16)
+	tracker.Track(Orders{ClientOrderId: "a", Status: PartialFilled, FilledQuantity: 1})
+
+	for _, update := range []Orders{
+		{ClientOrderId: "a", Status: Accepted, FilledQuantity: 1},
+		{ClientOrderId: "a", Status: PartialFilled, FilledQuantity: 0.5},
+	} {
+		err := tracker.Apply(update)
+		var transition *TransitionError
+		if !errors.As(err, &transition) {
+			t.Errorf("Apply(%+v) = %v", update, err)
+		}
+		if got := eventTypes(tracker); !sameTypes(got, []orderEventType{OrderInvalidEvent}) {
+			t.Errorf("Apply(%+v) events = %v", update, got)
+		}
+	}
+	if o, _ := tracker.Order("a"); o.Status != PartialFilled || o.FilledQuantity != 1 {
+		t.Errorf("order after invalid updates = %+v", o)
+	}
+}
+
+// Apply must not block when nobody reads the events.
+func TestOrderTrackerDropsEvents(t *testing.T) {
+	tracker := NewOrderTracker(1)
+	tracker.Track(Orders{ClientOrderId: "a"})
+
+	tracker.Apply(Orders{ClientOrderId: "a", Status: Accepted})
+	tracker.Apply(Orders{ClientOrderId: "a", Status: Filled, FilledQuantity: 1})
+	if n := tracker.Dropped(); n != 3 {
+		t.Errorf("dropped %d events, want 3", n)
+	}
+	if o, _ := tracker.Order("a"); o.Status != Filled {
+		t.Errorf("order = %+v", o)
+	}
+	if got := eventTypes(tracker); !sameTypes(got, []orderEventType{OrderStatusEvent}) {
+		t.Errorf("events = %v", got)
+	}
+}
+
+// Events of concurrent updates are emitted in the order the updates were
+// applied. Run with -race.
+func TestOrderTrackerEventOrder(t *testing.T) {
+	tracker := NewOrderTracker(1000)
+	tracker.Track(Orders{ClientOrderId: "a", Status: Accepted})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 1; j <= 50; j++ {
+				tracker.Apply(Orders{ClientOrderId: "a", Status: PartialFilled, FilledQuantity: float64(j*8 + i)})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	filled := 0.0
+	for len(tracker.Events()) > 0 {
+		ev := <-tracker.Events()
+		if ev.Type != OrderFillEvent {
+			continue
+		}
+		if ev.Order.FilledQuantity <= filled {
+			t.Fatalf("fill to %v emitted after a fill to %v", ev.Order.FilledQuantity, filled)
+		}
+		filled = ev.Order.FilledQuantity
+	}
+	if o, _ := tracker.Order("a"); o.FilledQuantity != filled {
+		t.Errorf("last fill event to %v, order filled %v", filled, o.FilledQuantity)
+	}
+}
+
+func TestOrderTrackerFollow(t *testing.T) {
+	tracker := NewOrderTracker(16)
+	tracker.Track(Orders{ClientOrderId: "a"})
+	tracker.Track(Orders{ClientOrderId: "b"})
+
+	updates := make(chan WSOrderReport, 4)
+	snapshots := make(chan []WSOrderReport, 1)
+	snapshots <- []WSOrderReport{
+		{ClientOrderID: "a", Status: Accepted},
+		{ClientOrderID: "other", Status: Accepted},
+	}
+	updates <- WSOrderReport{ClientOrderID: "b", Status: Filled, CumQuantity: 1}
+	updates <- WSOrderReport{ClientOrderID: "b", Status: Accepted, CumQuantity: 1}
+	close(updates)
+	close(snapshots)
+
+	err := tracker.Follow(&ReportsSubscription{Updates: updates, Snapshots: snapshots})
+	var transition *TransitionError
+	if !errors.As(err, &transition) || transition.ClientOrderId != "b" || transition.To != Accepted {
+		t.Errorf("Follow = %v", err)
+	}
+	if a, _ := tracker.Order("a"); a.Status != Accepted {
+		t.Errorf("order a = %+v", a)
+	}
+	if b, _ := tracker.Order("b"); b.Status != Filled {
+		t.Errorf("order b = %+v", b)
+	}
+}
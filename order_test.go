@@ -0,0 +1,26 @@
+package spiral
+
+import "testing"
+
+func TestFormatAmount(t *testing.T) {
+	for _, c := range []struct {
+		f    float64
+		want string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{0.05, "0.05"},
+		{0.1 + 0.2, "0.3"},
+		{1.1 * 3, "3.3"},
+		{0.000000001, "0.000000001"},
+		{0.123456789012345678, "0.12345678901235"},
+		{12345678.9, "12345678.9"},
+		{12345678.123456789, "12345678.12345679"},
+		{-0.5, "-0.5"},
+		{-0.0000000000000001, "0"},
+	} {
+		if got := FormatAmount(c.f); got != c.want {
+			t.Errorf("FormatAmount(%v) = %s, want %s", c.f, got, c.want)
+		}
+	}
+}
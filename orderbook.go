@@ -1,9 +1,6 @@
 package spiral
 
-import (
-	"encoding/json"
-	"strconv"
-)
+import "encoding/json"
 
 type OrderbookReturn struct {
 	Symbol       string          `json:"symbol"`
@@ -18,21 +15,21 @@ type OrderbookData struct {
 	Side  side
 }
 
+// UnmarshalJSON decodes the [price, size, side] array sent by the API.
+// Price and size may be encoded as JSON strings or numbers.
 func (r *OrderbookData) UnmarshalJSON(bs []byte) error {
-	arr := []interface{}{}
-	if err := json.Unmarshal(bs, &arr); err != nil {
-		return err
-	}
+	d := newArrayDecoder("OrderbookData", bs, 3)
 
-	var err error
-	if r.Price, err = strconv.ParseFloat(arr[0].(string), 64); err != nil {
-		return err
+	row := OrderbookData{
+		Price: d.float(0, "Price"),
+		Size:  d.float(1, "Size"),
+		Side:  side(d.string(2, "Side")),
 	}
-	if r.Size, err = strconv.ParseFloat(arr[1].(string), 64); err != nil {
-		return err
+	if d.err != nil {
+		return d.err
 	}
-	r.Side = side(arr[2].(string))
 
+	*r = row
 	return nil
 }
 
@@ -0,0 +1,278 @@
+package spiral
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// scrubbedHeaders are never written to fixture files.
+var scrubbedHeaders = []string{"api-key", "api-signature", "api-expires", "Authorization", "Cookie", "Set-Cookie"}
+
+// scrubbedParams are the query, form and JSON body parameters never written
+// to fixture files, compared case-insensitively.
+var scrubbedParams = []string{"api_key", "apikey", "api-key", "key", "secret", "api_secret", "apisecret",
+	"signature", "sign", "nonce", "expires", "password", "passphrase", "token"}
+
+const scrubbedValue = "[scrubbed]"
+
+// Fixture is a recorded HTTP request/response pair.
+type Fixture struct {
+	Request  FixtureRequest  `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+// FixtureRequest is the recorded part of a request, used to match replayed requests.
+type FixtureRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Params string      `json:"params"` // normalised query and body parameters
+	Header http.Header `json:"header,omitempty"`
+}
+
+// FixtureResponse is the recorded part of a response.
+type FixtureResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// key identifies the requests a fixture can answer.
+func (r FixtureRequest) key() string {
+	return fmt.Sprintf("%s %s?%s", r.Method, r.Path, r.Params)
+}
+
+// Recorder is an http.RoundTripper that forwards requests to the underlying
+// transport and writes every request/response pair to a fixture file in Dir.
+//
+//	rec := spiral.NewRecorder("testdata/session", nil)
+//	api := spiral.NewWithCustomHttpClient(key, secret, &http.Client{Transport: rec})
+type Recorder struct {
+	Dir       string
+	Transport http.RoundTripper
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecorder returns a Recorder writing fixtures to dir. If transport is nil
+// http.DefaultTransport is used.
+func NewRecorder(dir string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{Dir: dir, Transport: transport}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	fixReq, err := newFixtureRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	fixture := Fixture{
+		Request: fixReq,
+		Response: FixtureResponse{
+			StatusCode: resp.StatusCode,
+			Header:     scrubHeader(resp.Header),
+			Body:       string(body),
+		},
+	}
+	if err = r.write(fixture); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func (r *Recorder) write(fixture Fixture) error {
+	bs, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(r.Dir, 0755); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	name := fmt.Sprintf("%04d_%s_%s.json", r.seq, fixture.Request.Method,
+		strings.Trim(unsafePathChars.ReplaceAllString(fixture.Request.Path, "_"), "_"))
+	return ioutil.WriteFile(filepath.Join(r.Dir, name), bs, 0644)
+}
+
+// Replayer is an http.RoundTripper answering requests from fixture files
+// written by a Recorder. Requests are matched by method, path and normalised
+// parameters; fixtures sharing the same match are replayed in recorded order
+// and the last one keeps answering once the others are used up.
+type Replayer struct {
+	mu       sync.Mutex
+	fixtures map[string][]Fixture
+}
+
+// NewReplayer loads every fixture file in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	r := &Replayer{fixtures: make(map[string][]Fixture)}
+	for _, file := range files {
+		bs, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var fixture Fixture
+		if err = json.Unmarshal(bs, &fixture); err != nil {
+			return nil, fmt.Errorf("spiral replay: %s: %v", file, err)
+		}
+		key := fixture.Request.key()
+		r.fixtures[key] = append(r.fixtures[key], fixture)
+	}
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	fixReq, err := newFixtureRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	key := fixReq.key()
+
+	r.mu.Lock()
+	queue := r.fixtures[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("spiral replay: no fixture recorded for %s", key)
+	}
+	fixture := queue[0]
+	if len(queue) > 1 {
+		r.fixtures[key] = queue[1:]
+	}
+	r.mu.Unlock()
+
+	header := fixture.Response.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.StatusCode, http.StatusText(fixture.Response.StatusCode)),
+		StatusCode:    fixture.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(fixture.Response.Body)),
+		ContentLength: int64(len(fixture.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// newFixtureRequest captures req without consuming its body. Credentials are
+// scrubbed from the parameters, so recorded and replayed requests match
+// whatever their keys, nonces and signatures.
+func newFixtureRequest(req *http.Request) (FixtureRequest, error) {
+	params := req.URL.Query()
+
+	// GET requests carry their query as body too, the query is authoritative.
+	if req.Body != nil && req.Method != "GET" {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return FixtureRequest{}, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		mergeBodyParams(params, body, req.Header.Get("Content-Type"))
+	}
+
+	return FixtureRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Params: scrubParams(params).Encode(),
+		Header: scrubHeader(req.Header),
+	}, nil
+}
+
+// mergeBodyParams adds the fields of a form encoded or JSON object body to
+// params, or the raw body when it is neither.
+func mergeBodyParams(params url.Values, body []byte, contentType string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k, v := range form {
+				params[k] = append(params[k], v...)
+			}
+			return
+		}
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		params.Add("_body", string(body))
+		return
+	}
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			params.Add(k, s)
+			continue
+		}
+		bs, _ := json.Marshal(v)
+		params.Add(k, string(bs))
+	}
+}
+
+func scrubParams(params url.Values) url.Values {
+	for k, v := range params {
+		for _, name := range scrubbedParams {
+			if strings.EqualFold(k, name) {
+				for i := range v {
+					v[i] = scrubbedValue
+				}
+			}
+		}
+	}
+	return params
+}
+
+func scrubHeader(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	clean := make(http.Header, len(h))
+	for k, v := range h {
+		clean[k] = append([]string(nil), v...)
+	}
+	for _, k := range scrubbedHeaders {
+		if clean.Get(k) != "" {
+			clean.Set(k, scrubbedValue)
+		}
+	}
+	return clean
+}
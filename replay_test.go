@@ -0,0 +1,159 @@
+package spiral
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rewriteHost sends every request to the host of base.
+type rewriteHost struct {
+	base *url.URL
+}
+
+func (r rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = r.base.Scheme
+	req.URL.Host = r.base.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newReplayAPI(t *testing.T, dir string) *Spiral {
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWithCustomHttpClient("key", "secret", &http.Client{Transport: replayer})
+}
+
+var replayOrder = Orders{
+	ClientOrderId: "replay-1",
+	Symbol:        "ETHBTC",
+	Side:          BidSide,
+	Type:          LimitOrderType,
+	Price:         0.05,
+	Quantity:      1,
+}
+
+func TestReplayFixtures(t *testing.T) {
+	api := newReplayAPI(t, "testdata/replay")
+
+	currencies, err := api.GetCurrencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(currencies) != 1 || currencies[0].Code != "BTC" || currencies[0].WithdrawalFee != 0.0005 {
+		t.Errorf("currencies = %+v", currencies)
+	}
+
+	balances, err := api.GetBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Available != 1.5 || balances[0].Timestamp.Unix() != 1546300800 {
+		t.Errorf("balances = %+v", balances)
+	}
+
+	placed, err := api.PlaceOrder(replayOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed.Order.Id != 42 || placed.Order.ClientOrderId != "replay-1" {
+		t.Errorf("placed = %+v", placed.Order)
+	}
+}
+
+func TestReplayUnmatchedRequest(t *testing.T) {
+	api := newReplayAPI(t, "testdata/replay")
+
+	if _, err := api.GetSymbols(); err == nil || !strings.Contains(err.Error(), "no fixture recorded for GET /api/v1/products") {
+		t.Errorf("GetSymbols error = %v", err)
+	}
+
+	order := replayOrder
+	order.Quantity = 2
+	if _, err := api.PlaceOrder(order); err == nil || !strings.Contains(err.Error(), "no fixture recorded") {
+		t.Errorf("PlaceOrder with other parameters error = %v", err)
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	const key, secret = "recorded-key", "recorded-secret"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/wallet/balances":
+			w.Write([]byte(`{"data":[{"currency":"ETH","available":"3","locked":"0","timestamp":1546300800}]}`))
+		case "/api/v1/order":
+			w.Write([]byte(`{"order":{"id":43,"clt_ord_id":"replay-1","status":"accepted"}}`))
+		case "/login":
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	base, _ := url.Parse(server.URL)
+
+	dir, err := ioutil.TempDir("", "spiral-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec := NewRecorder(dir, rewriteHost{base})
+	api := NewWithCustomHttpClient(key, secret, &http.Client{Transport: rec})
+	if _, err = api.GetBalances(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = api.PlaceOrder(replayOrder); err != nil {
+		t.Fatal(err)
+	}
+
+	// credentials sent in headers, JSON bodies and forms are never recorded
+	form, _ := http.NewRequest("POST", server.URL+"/login?apiKey="+key, strings.NewReader("secret="+secret+"&signature=abc&user=bob"))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := (&http.Client{Transport: rec}).Do(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("recorded %d fixtures, want 3", len(files))
+	}
+	for _, file := range files {
+		bs, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, leaked := range []string{key, secret, "abc"} {
+			if strings.Contains(string(bs), leaked) {
+				t.Errorf("%s contains %q:\n%s", filepath.Base(file), leaked, bs)
+			}
+		}
+	}
+
+	// the replay answers with other credentials and never reaches the server
+	server.Close()
+	replay := newReplayAPI(t, dir)
+	balances, err := replay.GetBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Currency != "ETH" || balances[0].Available != 3 {
+		t.Errorf("balances = %+v", balances)
+	}
+	placed, err := replay.PlaceOrder(replayOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed.Order.Id != 43 || placed.Order.Status != Accepted {
+		t.Errorf("placed = %+v", placed.Order)
+	}
+}
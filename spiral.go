@@ -17,19 +17,19 @@ const (
 // New returns an instantiated HitBTC struct
 func New(apiKey, apiSecret string) *Spiral {
 	client := NewClient(apiKey, apiSecret)
-	return &Spiral{client}
+	return &Spiral{client: client}
 }
 
 // NewWithCustomHttpClient returns an instantiated HitBTC struct with custom http client
 func NewWithCustomHttpClient(apiKey, apiSecret string, httpClient *http.Client) *Spiral {
 	client := NewClientWithCustomHttpConfig(apiKey, apiSecret, httpClient)
-	return &Spiral{client}
+	return &Spiral{client: client}
 }
 
 // NewWithCustomTimeout returns an instantiated HitBTC struct with custom timeout
 func NewWithCustomTimeout(apiKey, apiSecret string, timeout time.Duration) *Spiral {
 	client := NewClientWithCustomTimeout(apiKey, apiSecret, timeout)
-	return &Spiral{client}
+	return &Spiral{client: client}
 }
 
 // handleErr gets JSON response from spiral API en deal with error
@@ -44,7 +44,8 @@ func handleErr(r errorResponse) error {
 
 // Spiral represent a Spiral client
 type Spiral struct {
-	client *client
+	client   *client
+	orderIDs *OrderIDGenerator // fills empty client order ids when set
 }
 
 // SetDebug sets enable/disable http request/response dump
@@ -90,12 +91,24 @@ func (b *Spiral) GetSymbols() (symbols []Symbol, err error) {
 }
 
 // GetKLines is used to fetch trading symbol kline data.
-func (b *Spiral) GetKLines(market string, p period, limit int) (kline []KLine, err error) {
+func (b *Spiral) GetKLines(market string, p Period, limit int) (kline []KLine, err error) {
+	return b.GetKLinesInRange(market, p, time.Time{}, time.Time{}, limit)
+}
+
+// GetKLinesInRange is used to fetch trading symbol kline data opened between start and end.
+// A zero start or end leaves the range open on that side.
+func (b *Spiral) GetKLinesInRange(market string, p Period, start, end time.Time, limit int) (kline []KLine, err error) {
 	params := map[string]string{
 		"symbol": market,
 		"period": string(p),
 		"limit":  strconv.Itoa(limit),
 	}
+	if !start.IsZero() {
+		params["start_time"] = timeParam(start)
+	}
+	if !end.IsZero() {
+		params["end_time"] = timeParam(end)
+	}
 	r, err := b.client.do("GET", "klines", params, false)
 	if err != nil {
 		return
@@ -209,17 +222,27 @@ func (b *Spiral) GetBalance(currency string) (balance Balance, err error) {
 // GetTrades used to retrieve your trade history.
 // market string literal for the market (ie. BTC/LTC). If set to "all", will return for all market
 func (b *Spiral) GetTrades(symbol string, count int) (trades []Trade, err error) {
+	return b.GetTradesInRange(symbol, count, time.Time{}, time.Time{})
+}
+
+// GetTradesInRange used to retrieve your trade history between start and end.
+// A zero start or end leaves the range open on that side.
+func (b *Spiral) GetTradesInRange(symbol string, count int, start, end time.Time) (trades []Trade, err error) {
 	payload := map[string]string{
 		"symbol": symbol,
 		"count":  "1000",
 		//"start":  strSymbol
 		//"reverse":strSymbol
-		//"start_time":strSymbol
-		//"end_time": strSymbol
 	}
 	if count > 0 {
 		payload["count"] = strconv.Itoa(count)
 	}
+	if !start.IsZero() {
+		payload["start_time"] = timeParam(start)
+	}
+	if !end.IsZero() {
+		payload["end_time"] = timeParam(end)
+	}
 
 	r, err := b.client.do("GET", "trades", payload, true)
 	if err != nil {
@@ -237,12 +260,43 @@ func (b *Spiral) GetTrades(symbol string, count int) (trades []Trade, err error)
 	return
 }
 
-// CancelOrder cancels a pending order
+// CancelOrder cancels a pending order. An OrderNotFoundError is returned when
+// there is none.
 func (b *Spiral) CancelOrder(orderId string) (err error) {
 	params := map[string]string{
 		"order_id": orderId,
 	}
 	r, err := b.client.do("DELETE", "order", params, true)
+	if isOrderNotFound(r) {
+		id, _ := strconv.ParseInt(orderId, 10, 64)
+		err = &OrderNotFoundError{Id: id}
+		return
+	}
+	if err != nil {
+		return
+	}
+	var response errorResponse
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+	if err = handleErr(response); err != nil {
+		return
+	}
+
+	return nil
+}
+
+// CancelOrderByClientID cancels the pending order having the client order id clientOrderId.
+// An OrderNotFoundError is returned when there is none.
+func (b *Spiral) CancelOrderByClientID(clientOrderId string) (err error) {
+	params := map[string]string{
+		"clt_ord_id": clientOrderId,
+	}
+	r, err := b.client.do("DELETE", "order", params, true)
+	if isOrderNotFound(r) {
+		err = &OrderNotFoundError{ClientOrderId: clientOrderId}
+		return
+	}
 	if err != nil {
 		return
 	}
@@ -278,6 +332,9 @@ func (b *Spiral) CancelAllOrder(symbol, filter string) error {
 }
 
 // GetOrder gets a pending order data.
+//
+// Deprecated: GetOrder sends orderId as clientOrderId, use GetOrderByID or
+// GetOrderByClientID.
 func (b *Spiral) GetOrder(orderId string) (orders []Orders, err error) {
 	payload := make(map[string]string)
 	payload["clientOrderId"] = orderId
@@ -297,8 +354,54 @@ func (b *Spiral) GetOrder(orderId string) (orders []Orders, err error) {
 	return
 }
 
+// GetOrderByID gets the order having the exchange id orderId. An
+// OrderNotFoundError is returned when there is none.
+func (b *Spiral) GetOrderByID(orderId int64) (order Orders, err error) {
+	params := map[string]string{
+		"order_id": strconv.FormatInt(orderId, 10),
+	}
+	return b.getOrder(params, func(o Orders) bool { return o.Id == orderId }, &OrderNotFoundError{Id: orderId})
+}
+
+// GetOrderByClientID gets the order having the client order id clientOrderId.
+// An OrderNotFoundError is returned when there is none.
+func (b *Spiral) GetOrderByClientID(clientOrderId string) (order Orders, err error) {
+	params := map[string]string{
+		"clt_ord_id": clientOrderId,
+	}
+	return b.getOrder(params, func(o Orders) bool { return o.ClientOrderId == clientOrderId }, &OrderNotFoundError{ClientOrderId: clientOrderId})
+}
+
+// getOrder gets the orders selected by params and returns the one matching,
+// notFound if none does or the API does not know the order.
+func (b *Spiral) getOrder(params map[string]string, match func(Orders) bool, notFound error) (order Orders, err error) {
+	r, err := b.client.do("GET", "order", params, true)
+	if isOrderNotFound(r) {
+		err = notFound
+		return
+	}
+	if err != nil {
+		return
+	}
+	var response OrdersReturn
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+	if err = handleErr(response.errorResponse); err != nil {
+		return
+	}
+
+	for _, o := range response.Orders {
+		if match(o) {
+			return o, nil
+		}
+	}
+	err = notFound
+	return
+}
+
 // GetOrderHistory gets the history of orders for an user.
-func (b *Spiral) GetOrderHistory(req orderGetRequest) (orders []Orders, err error) {
+func (b *Spiral) GetOrderHistory(req OrderGetRequest) (orders []Orders, err error) {
 	params := map[string]string{
 		"symbol":  req.Symbol,
 		"side":    string(req.Side),
@@ -306,6 +409,12 @@ func (b *Spiral) GetOrderHistory(req orderGetRequest) (orders []Orders, err erro
 		"count":   strconv.Itoa(req.Count),
 		"reverse": fmt.Sprint(req.Reverse),
 	}
+	if !req.StartTime.IsZero() {
+		params["start_time"] = timeParam(req.StartTime)
+	}
+	if !req.EndTime.IsZero() {
+		params["end_time"] = timeParam(req.EndTime)
+	}
 	r, err := b.client.do("GET", "order", params, true)
 	if err != nil {
 		return
@@ -351,10 +460,14 @@ func (b *Spiral) GetOpenOrders(count int) (orders []Orders, err error) {
 	return
 }
 
-// PlaceOrder creates a new order.
+// PlaceOrder creates a new order. An empty client order id is filled by the
+// generator set with SetOrderIDGenerator, if any.
 func (b *Spiral) PlaceOrder(requestOrder Orders) (resp PlaceReturn, err error) {
 	payload := make(map[string]string)
 
+	if requestOrder.ClientOrderId == "" && b.orderIDs != nil {
+		requestOrder.ClientOrderId = b.orderIDs.Next()
+	}
 	payload["clt_ord_id"] = requestOrder.ClientOrderId
 	payload["symbol"] = requestOrder.Symbol
 	payload["side"] = string(requestOrder.Side)
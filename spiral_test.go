@@ -0,0 +1,123 @@
+package spiral
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const unknownOrder = `{"error_code":20002,"message":"Order not found"}`
+
+// newLookupServer returns a client of a server answering the order requests
+// having order_id or clt_ord_id, in the query or the JSON body, with the
+// response of that value, sent with status when it is an unknown order.
+func newLookupServer(t *testing.T, status int, responses map[string]string) *Spiral {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		for key := range r.URL.Query() {
+			params[key] = r.URL.Query().Get(key)
+		}
+		json.NewDecoder(r.Body).Decode(&params) // parameters of DELETE requests
+		response, ok := responses[params["order_id"]+params["clt_ord_id"]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if response == unknownOrder {
+			w.WriteHeader(status)
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	base, _ := url.Parse(server.URL)
+	return NewWithCustomHttpClient("key", "secret", &http.Client{Transport: rewriteHost{base}})
+}
+
+func TestOrderLookups(t *testing.T) {
+	responses := map[string]string{
+		"42":      `{"orders":[` + placedOrder + `]}`,
+		"idem-1":  `{"orders":[` + placedOrder + `]}`,
+		"43":      `{"orders":[]}`,
+		"empty-1": `{"orders":[]}`,
+		"44":      unknownOrder,
+		"gone-1":  unknownOrder,
+		"45":      `{"error_code":1,"message":"bad request"}`,
+	}
+
+	// the API may send the error of an unknown order with or without an error status
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+		api := newLookupServer(t, status, responses)
+
+		for _, c := range []struct {
+			name          string
+			get           func() (Orders, error)
+			id            int64
+			clientOrderId string
+			found         bool
+		}{
+			{"found by id", func() (Orders, error) { return api.GetOrderByID(42) }, 42, "", true},
+			{"found by client id", func() (Orders, error) { return api.GetOrderByClientID("idem-1") }, 0, "idem-1", true},
+			{"empty result by id", func() (Orders, error) { return api.GetOrderByID(43) }, 43, "", false},
+			{"empty result by client id", func() (Orders, error) { return api.GetOrderByClientID("empty-1") }, 0, "empty-1", false},
+			{"unknown id", func() (Orders, error) { return api.GetOrderByID(44) }, 44, "", false},
+			{"unknown client id", func() (Orders, error) { return api.GetOrderByClientID("gone-1") }, 0, "gone-1", false},
+		} {
+			o, err := c.get()
+			if c.found {
+				if err != nil || o.Id != 42 || o.ClientOrderId != "idem-1" {
+					t.Errorf("%d %s: order = %+v, %v", status, c.name, o, err)
+				}
+				continue
+			}
+			var notFound *OrderNotFoundError
+			if !errors.As(err, &notFound) || notFound.Id != c.id || notFound.ClientOrderId != c.clientOrderId {
+				t.Errorf("%d %s: error = %v", status, c.name, err)
+			}
+		}
+	}
+
+	// other errors are returned as they are
+	api := newLookupServer(t, http.StatusOK, responses)
+	_, err := api.GetOrderByID(45)
+	var notFound *OrderNotFoundError
+	if err == nil || errors.As(err, &notFound) {
+		t.Errorf("GetOrderByID of a bad request = %v", err)
+	}
+	_, err = api.GetOrderByID(46)
+	var status *StatusError
+	if !errors.As(err, &status) || status.Code != http.StatusNotFound {
+		t.Errorf("GetOrderByID answered 404 = %v", err)
+	}
+}
+
+func TestCancelOrderNotFound(t *testing.T) {
+	responses := map[string]string{
+		"42":     `{"error_code":0}`,
+		"idem-1": `{"error_code":0}`,
+		"44":     unknownOrder,
+		"gone-1": unknownOrder,
+		"45":     `{"error_code":1,"message":"bad request"}`,
+	}
+	api := newLookupServer(t, http.StatusBadRequest, responses)
+
+	if err := api.CancelOrder("42"); err != nil {
+		t.Errorf("CancelOrder = %v", err)
+	}
+	if err := api.CancelOrderByClientID("idem-1"); err != nil {
+		t.Errorf("CancelOrderByClientID = %v", err)
+	}
+
+	var notFound *OrderNotFoundError
+	if err := api.CancelOrder("44"); !errors.As(err, &notFound) || notFound.Id != 44 {
+		t.Errorf("CancelOrder of an unknown order = %v", err)
+	}
+	if err := api.CancelOrderByClientID("gone-1"); !errors.As(err, &notFound) || notFound.ClientOrderId != "gone-1" {
+		t.Errorf("CancelOrderByClientID of an unknown order = %v", err)
+	}
+	if err := api.CancelOrder("45"); err == nil || err.Error() != "bad request" {
+		t.Errorf("CancelOrder of a bad request = %v", err)
+	}
+}
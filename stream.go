@@ -0,0 +1,243 @@
+package spiral
+
+import (
+	"github.com/juju/errors"
+)
+
+// MarketStream streams market data in the transport independent models.
+//
+// StreamClient implements it with the Spiral streaming protocol, WSClient
+// with the HitBTC style JSON RPC protocol and WSPool with several JSON RPC
+// connections.
+type MarketStream interface {
+	StreamBook(symbol string, opts ...FeedOptions) (*BookStream, error)
+	StreamTrades(symbol string, opts ...FeedOptions) (*TradeStream, error)
+	StreamCandles(symbol string, p Period, opts ...FeedOptions) (*CandleStream, error)
+	ConnectionEvents() <-chan ConnectionEvent
+	Errors() <-chan error
+	Done() <-chan struct{}
+	Close()
+}
+
+var (
+	_ MarketStream = (*StreamClient)(nil)
+	_ MarketStream = (*WSClient)(nil)
+	_ MarketStream = (*WSPool)(nil)
+)
+
+type streamProtocol int
+
+const (
+	// SpiralProtocol is the streaming protocol of the Spiral API.
+	SpiralProtocol streamProtocol = iota
+	// HitBTCProtocol is the JSON RPC protocol of WSClient.
+	HitBTCProtocol
+)
+
+// NewMarketStream connects a market stream speaking protocol. The URL of cfg
+// defaults to the endpoint of the protocol.
+func NewMarketStream(protocol streamProtocol, cfg WSConfig) (MarketStream, error) {
+	switch protocol {
+	case SpiralProtocol:
+		return NewStreamClient(cfg)
+	case HitBTCProtocol:
+		return NewWSClientWithConfig(cfg)
+	default:
+		return nil, errors.Errorf("Spiral NewMarketStream: unknown protocol %d", protocol)
+	}
+}
+
+// BookStream is a subscription to the order book of a market. The first book
+// is a snapshot, the following ones are deltas unless the server sends a new
+// snapshot.
+type BookStream struct {
+	*Subscription
+	Updates <-chan Book
+}
+
+// TradeStream is a subscription to the trades of a market.
+type TradeStream struct {
+	*Subscription
+	Updates <-chan MarketTrade
+}
+
+// CandleStream is a subscription to the candles of a market. A candle is sent
+// again each time it changes until it closes.
+type CandleStream struct {
+	*Subscription
+	Updates <-chan Candle
+}
+
+func newBookStream(s *Subscription) *BookStream {
+	return &BookStream{Subscription: s, Updates: s.feed.updates.(<-chan Book)}
+}
+
+func newTradeStream(s *Subscription) *TradeStream {
+	return &TradeStream{Subscription: s, Updates: s.feed.updates.(<-chan MarketTrade)}
+}
+
+func newCandleStream(s *Subscription) *CandleStream {
+	return &CandleStream{Subscription: s, Updates: s.feed.updates.(<-chan Candle)}
+}
+
+// StreamBook subscribes to the order book of symbol in the transport independent model.
+func (c *WSClient) StreamBook(symbol string, opts ...FeedOptions) (*BookStream, error) {
+	req := orderbookRequest(symbol)
+	req.create = bookFeed
+	s, err := c.subscribe(req, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamBook")
+	}
+	return newBookStream(s), nil
+}
+
+// StreamTrades subscribes to the trades of symbol in the transport independent model.
+func (c *WSClient) StreamTrades(symbol string, opts ...FeedOptions) (*TradeStream, error) {
+	req := tradesRequest(symbol)
+	req.create = marketTradesFeed
+	s, err := c.subscribe(req, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamTrades")
+	}
+	return newTradeStream(s), nil
+}
+
+// StreamCandles subscribes to the candles of symbol and period p in the
+// transport independent model.
+func (c *WSClient) StreamCandles(symbol string, p Period, opts ...FeedOptions) (*CandleStream, error) {
+	timeframe := p.interval()
+	if timeframe == "" {
+		return nil, errors.Errorf("Spiral StreamCandles: period %q not streamed", string(p))
+	}
+	req := candlesRequest(symbol, timeframe)
+	req.create = candleFeed
+	s, err := c.subscribe(req, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamCandles")
+	}
+	return newCandleStream(s), nil
+}
+
+// bookFeed delivers order book notifications of either protocol as Books.
+func bookFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan Book)
+	f := newFeed(key, newFeedQueue(opts, mergeBooks), func(msg interface{}, done <-chan struct{}) bool {
+		var b Book
+		switch m := msg.(type) {
+		case Book:
+			b = m
+		case WSNotificationOrderbookSnapshot:
+			b = m.Book()
+		case WSNotificationOrderbookUpdate:
+			b = m.Book()
+		default:
+			return true
+		}
+		select {
+		case updates <- b:
+			return true
+		case <-done:
+			return false
+		}
+	}, func() { close(updates) })
+	f.updates = (<-chan Book)(updates)
+	return f
+}
+
+// marketTradesFeed delivers trade notifications of either protocol one MarketTrade at a time.
+func marketTradesFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan MarketTrade)
+	f := newFeed(key, newFeedQueue(opts, nil), func(msg interface{}, done <-chan struct{}) bool {
+		var trades []MarketTrade
+		switch m := msg.(type) {
+		case []MarketTrade:
+			trades = m
+		case WSNotificationTradesSnapshot:
+			trades = m.MarketTrades()
+		case WSNotificationTradesUpdate:
+			trades = m.MarketTrades()
+		}
+		for _, t := range trades {
+			select {
+			case updates <- t:
+			case <-done:
+				return false
+			}
+		}
+		return true
+	}, func() { close(updates) })
+	f.updates = (<-chan MarketTrade)(updates)
+	return f
+}
+
+// candleFeed delivers candle notifications of either protocol one Candle at a
+// time. Notifications that cannot be converted are counted as dropped.
+func candleFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan Candle)
+	var f *feed
+	f = newFeed(key, newFeedQueue(opts, nil), func(msg interface{}, done <-chan struct{}) bool {
+		var candles []Candle
+		var err error
+		switch m := msg.(type) {
+		case []Candle:
+			candles = m
+		case WSNotificationCandlesSnapshot:
+			candles, err = m.Candles()
+		case WSNotificationCandlesUpdate:
+			candles, err = m.Candles()
+		}
+		if err != nil {
+			f.discard()
+			return true
+		}
+		for _, c := range candles {
+			select {
+			case updates <- c:
+			case <-done:
+				return false
+			}
+		}
+		return true
+	}, func() { close(updates) })
+	f.updates = (<-chan Candle)(updates)
+	return f
+}
+
+// mergeBooks conflates Books like mergeOrderbook conflates order book notifications.
+func mergeBooks(prev, next interface{}) (interface{}, bool) {
+	p, ok := prev.(Book)
+	n, nok := next.(Book)
+	if !ok || !nok {
+		return mergeOrderbook(prev, next)
+	}
+	if !n.Delta {
+		return n, true
+	}
+	return newBook(p.Symbol, n.Sequence, p.Delta, mergeItems(p.Bid, n.Bid, !p.Delta), mergeItems(p.Ask, n.Ask, !p.Delta)), true
+}
+
+// mergeItems applies the levels of next over prev. Levels of size 0 are
+// removed when merging into a snapshot and kept as removals otherwise.
+func mergeItems(prev, next []OrderBookItem, snapshot bool) []OrderBookItem {
+	merged := make([]OrderBookItem, 0, len(prev)+len(next))
+	index := make(map[float64]int, len(prev)+len(next))
+	for _, level := range append(append([]OrderBookItem(nil), prev...), next...) {
+		if i, ok := index[level.Price]; ok {
+			merged[i] = level
+			continue
+		}
+		index[level.Price] = len(merged)
+		merged = append(merged, level)
+	}
+	if !snapshot {
+		return merged
+	}
+
+	kept := merged[:0]
+	for _, level := range merged {
+		if level.Size != 0 {
+			kept = append(kept, level)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,510 @@
+package spiral
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/juju/errors"
+)
+
+const wsStreamURL string = "wss://api.spiral.exchange/ws"
+
+// streamCommand is a command sent to the Spiral streaming API.
+type streamCommand struct {
+	Op   string   `json:"op"`
+	Args []string `json:"args"`
+}
+
+// streamMessage is a message of the Spiral streaming API, either the
+// acknowledgement of a command or data of a table.
+//
+//	{"success":true,"subscribe":"orderbook:BTCUSDT","request":{"op":"subscribe","args":["orderbook:BTCUSDT"]}}
+//	{"table":"orderbook","action":"partial","data":{...}}
+//
+// testdata/stream holds a message of each table and acknowledgement decoded
+// by the tests.
+type streamMessage struct {
+	Success     *bool          `json:"success"`
+	Subscribe   string         `json:"subscribe"`
+	Unsubscribe string         `json:"unsubscribe"`
+	Error       string         `json:"error"`
+	Request     *streamCommand `json:"request"`
+
+	Table  string          `json:"table"`
+	Action string          `json:"action"` // partial, update or insert
+	Data   json.RawMessage `json:"data"`
+}
+
+// streamAck is the outcome of a command.
+type streamAck struct {
+	success bool
+	err     string
+}
+
+// streamCandles is the data of the candles table.
+type streamCandles struct {
+	Symbol string  `json:"symbol"`
+	Period Period  `json:"period"`
+	Data   []KLine `json:"data"`
+}
+
+// StreamClient is a WebSocket client of the Spiral streaming API.
+//
+// Topics are the keys of the subscriptions: orderbook:BTCUSDT, trades:BTCUSDT
+// and candles:BTCUSDT:60. Like WSClient, the connection is supervised and
+// every topic is subscribed again after a reconnection.
+type StreamClient struct {
+	latency int64 // round trip time in nanoseconds, first for atomic alignment
+	config  WSConfig
+	updates *responseChannels
+
+	*supervisor
+
+	subMu   sync.Mutex // serialises the first and last references of topics
+	writeMu sync.Mutex // gorilla connections support a single writer
+
+	mu     sync.Mutex
+	ws     *websocket.Conn
+	topics map[string]bool
+	acks   map[string][]chan streamAck // pending commands by op and topic, oldest first
+}
+
+// NewStreamClient connects a client of the Spiral streaming API as set by
+// cfg, which URL defaults to the Spiral streaming endpoint.
+func NewStreamClient(cfg WSConfig) (*StreamClient, error) {
+	if cfg.URL == "" {
+		cfg.URL = wsStreamURL
+	}
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &StreamClient{
+		config: cfg,
+		updates: &responseChannels{
+			feeds:     newFeedRegistry(),
+			inbox:     newFeedQueue(FeedOptions{Buffer: wsInboxSize, Policy: DropNewestPolicy}, nil),
+			ErrorFeed: make(chan error, 16),
+		},
+		topics: make(map[string]bool),
+		acks:   make(map[string][]chan streamAck),
+	}
+	c.supervisor = newSupervisor(cfg, c)
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	go c.updates.dispatch(c.closed)
+
+	return c, nil
+}
+
+// Close closes the connection.
+//
+// Every subscribed channel is closed before Close returns.
+func (c *StreamClient) Close() {
+	c.terminate(ErrWSClientClosed)
+}
+
+// terminate closes the client for good, recording cause as its Err.
+func (c *StreamClient) terminate(cause error) {
+	c.stop(cause)
+	c.mu.Lock()
+	c.ws.Close()
+	c.mu.Unlock()
+
+	c.updates.feeds.closeAll()
+}
+
+// Errors returns the channel reporting messages that could not be decoded and
+// commands rejected by the server, like WSClient.Errors.
+func (c *StreamClient) Errors() <-chan error {
+	return c.updates.ErrorFeed
+}
+
+// Done returns a channel closed once the client is terminated, either by Close
+// or because the connection could not be restored.
+func (c *StreamClient) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Err returns the cause of the termination once Done is closed, nil before.
+func (c *StreamClient) Err() error {
+	select {
+	case <-c.closed:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// ConnectionEvents returns the channel notifying connection state changes.
+// Events are dropped when the channel is not read.
+func (c *StreamClient) ConnectionEvents() <-chan ConnectionEvent {
+	return c.events
+}
+
+// FeedStats returns the buffering state of every subscribed feed.
+func (c *StreamClient) FeedStats() []FeedStats {
+	return c.updates.feeds.stats()
+}
+
+// Latency returns the round trip time measured by the last ping, zero until
+// the first pong is received.
+func (c *StreamClient) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.latency))
+}
+
+// StreamBook subscribes to the order book of symbol.
+func (c *StreamClient) StreamBook(symbol string, opts ...FeedOptions) (*BookStream, error) {
+	s, err := c.subscribe(subscriptionKey("orderbook", symbol), bookFeed, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamBook")
+	}
+	return newBookStream(s), nil
+}
+
+// StreamTrades subscribes to the trades of symbol.
+func (c *StreamClient) StreamTrades(symbol string, opts ...FeedOptions) (*TradeStream, error) {
+	s, err := c.subscribe(subscriptionKey("trades", symbol), marketTradesFeed, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamTrades")
+	}
+	return newTradeStream(s), nil
+}
+
+// StreamCandles subscribes to the candles of symbol and period p.
+func (c *StreamClient) StreamCandles(symbol string, p Period, opts ...FeedOptions) (*CandleStream, error) {
+	s, err := c.subscribe(subscriptionKey("candles", symbol, string(p)), candleFeed, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamCandles")
+	}
+	return newCandleStream(s), nil
+}
+
+// subscribe registers a new feed of topic, subscribing to it on the server
+// if it is the first one.
+func (c *StreamClient) subscribe(topic string, create func(key string, opts FeedOptions) *feed, opts FeedOptions) (*Subscription, error) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	select {
+	case <-c.closed:
+		return nil, ErrWSClientClosed
+	default:
+	}
+
+	f, first, err := c.updates.feeds.add(topic, opts, create)
+	if err != nil {
+		return nil, err
+	}
+	if first {
+		if err := c.command("subscribe", topic); err != nil {
+			c.updates.feeds.remove(f)
+			return nil, err
+		}
+		c.mu.Lock()
+		c.topics[topic] = true
+		c.mu.Unlock()
+	}
+	return &Subscription{owner: c, feed: f}, nil
+}
+
+// resync subscribes again to the topic of f, which makes the server send a
+// new snapshot.
+func (c *StreamClient) resync(f *feed) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if !c.updates.feeds.contains(f) {
+		return ErrSubscriptionClosed
+	}
+	return c.command("subscribe", f.key)
+}
+
+// release unregisters f, unsubscribing from its topic if it was the last
+// feed of it.
+func (c *StreamClient) release(f *feed) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	found, last := c.updates.feeds.remove(f)
+	if !found || !last {
+		return nil
+	}
+	c.mu.Lock()
+	delete(c.topics, f.key)
+	c.mu.Unlock()
+	return c.command("unsubscribe", f.key)
+}
+
+// command sends op for topic and waits for the server to acknowledge it.
+// Rejected commands are reported on Errors as well.
+func (c *StreamClient) command(op, topic string) error {
+	pending, err := c.send(op, topic)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.CallTimeout)
+	defer cancel()
+	return c.await(ctx, pending)
+}
+
+// pendingCommand is a command sent and waiting for its acknowledgement.
+type pendingCommand struct {
+	id  string
+	ack chan streamAck
+}
+
+// send sends op for topic, registering the command so its acknowledgement
+// can be awaited. Acknowledgements only name the op and topic, so the
+// commands sent for the same topic are acknowledged in the order they were
+// sent.
+func (c *StreamClient) send(op, topic string) (pendingCommand, error) {
+	pending := pendingCommand{id: op + " " + topic, ack: make(chan streamAck, 1)}
+	c.mu.Lock()
+	c.acks[pending.id] = append(c.acks[pending.id], pending.ack)
+	c.mu.Unlock()
+
+	if err := c.write(streamCommand{Op: op, Args: []string{topic}}); err != nil {
+		c.unregister(pending)
+		return pending, errors.Annotatef(err, "Spiral %s", pending.id)
+	}
+	return pending, nil
+}
+
+// await waits for the acknowledgement of a command sent until ctx is done,
+// then unregisters it.
+func (c *StreamClient) await(ctx context.Context, pending pendingCommand) error {
+	defer c.unregister(pending)
+	select {
+	case a := <-pending.ack:
+		if !a.success {
+			err := errors.Errorf("Spiral %s: %s", pending.id, a.err)
+			c.updates.reportError(err)
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.Errorf("Spiral %s: not acknowledged", pending.id)
+	case <-c.closed:
+		return ErrWSClientClosed
+	}
+}
+
+// unregister removes the command from the pending ones, unless it was
+// acknowledged already.
+func (c *StreamClient) unregister(pending pendingCommand) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	acks := c.acks[pending.id]
+	for i, ack := range acks {
+		if ack == pending.ack {
+			c.setAcks(pending.id, append(acks[:i:i], acks[i+1:]...))
+			return
+		}
+	}
+}
+
+// setAcks sets the pending commands of id. The caller holds mu.
+func (c *StreamClient) setAcks(id string, acks []chan streamAck) {
+	if len(acks) == 0 {
+		delete(c.acks, id)
+		return
+	}
+	c.acks[id] = acks
+}
+
+// write sends v on the current connection.
+func (c *StreamClient) write(v interface{}) error {
+	c.mu.Lock()
+	ws := c.ws
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	ws.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	return ws.WriteJSON(v)
+}
+
+// connect opens a new connection reading its messages until it drops, which
+// closes the returned channel after recording why in the connError.
+func (c *StreamClient) connect() (<-chan struct{}, *connError, error) {
+	ws, _, err := c.config.Dialer.Dial(c.config.URL, c.config.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+	watchPongs(ws, c.config, &c.latency)
+
+	c.mu.Lock()
+	c.ws = ws
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	lost := &connError{}
+	go c.read(ws, done, lost)
+	go keepAlive(ws, c.config, done, lost)
+	return done, lost, nil
+}
+
+// read handles the messages of ws until it fails, then records the error in
+// lost and closes done.
+func (c *StreamClient) read(ws *websocket.Conn, done chan struct{}, lost *connError) {
+	defer close(done)
+	defer ws.Close()
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			lost.set(err)
+			return
+		}
+		ws.SetReadDeadline(time.Now().Add(c.config.PongTimeout))
+		c.handle(data)
+	}
+}
+
+// handle acknowledges a pending command or queues the data of a table for
+// dispatch to its feeds.
+func (c *StreamClient) handle(data []byte) {
+	var msg streamMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.updates.reportError(errors.Annotate(err, "Spiral stream message"))
+		return
+	}
+
+	if msg.Success != nil || msg.Table == "" {
+		c.acknowledge(msg)
+		return
+	}
+
+	delta := msg.Action != "partial"
+	switch msg.Table {
+	case "orderbook":
+		var book OrderbookReturn
+		if c.decode(msg.Table, msg.Data, &book) {
+			c.updates.enqueue(subscriptionKey("orderbook", book.Symbol), streamBook(book, delta))
+		}
+	case "trades":
+		var trades []Trade
+		if c.decode(msg.Table, msg.Data, &trades) {
+			bySymbol := make(map[string][]MarketTrade)
+			var symbols []string
+			for _, t := range trades {
+				if _, ok := bySymbol[t.Symbol]; !ok {
+					symbols = append(symbols, t.Symbol)
+				}
+				bySymbol[t.Symbol] = append(bySymbol[t.Symbol], t.MarketTrade())
+			}
+			for _, symbol := range symbols {
+				c.updates.enqueue(subscriptionKey("trades", symbol), bySymbol[symbol])
+			}
+		}
+	case "candles":
+		var candles streamCandles
+		if c.decode(msg.Table, msg.Data, &candles) {
+			converted := make([]Candle, len(candles.Data))
+			for i, k := range candles.Data {
+				converted[i] = k.Candle(candles.Symbol, candles.Period)
+			}
+			c.updates.enqueue(subscriptionKey("candles", candles.Symbol, string(candles.Period)), converted)
+		}
+	}
+}
+
+func (c *StreamClient) decode(table string, data json.RawMessage, v interface{}) bool {
+	if err := json.Unmarshal(data, v); err != nil {
+		c.updates.reportError(errors.Annotatef(err, "Spiral %s table", table))
+		return false
+	}
+	return true
+}
+
+// acknowledge hands the outcome of a command to the caller of the oldest
+// pending one of its op and topic. Errors matching no pending command are
+// reported on Errors.
+func (c *StreamClient) acknowledge(msg streamMessage) {
+	op, topic := "subscribe", msg.Subscribe
+	if msg.Unsubscribe != "" {
+		op, topic = "unsubscribe", msg.Unsubscribe
+	}
+	if topic == "" && msg.Request != nil && len(msg.Request.Args) > 0 {
+		op, topic = msg.Request.Op, msg.Request.Args[0]
+	}
+
+	id := op + " " + topic
+	c.mu.Lock()
+	acks := c.acks[id]
+	var ack chan streamAck
+	if len(acks) > 0 {
+		ack = acks[0]
+		c.setAcks(id, acks[1:])
+	}
+	c.mu.Unlock()
+	if ack == nil {
+		if msg.Error != "" {
+			c.updates.reportError(errors.Errorf("Spiral stream: %s", msg.Error))
+		}
+		return
+	}
+	select {
+	case ack <- streamAck{success: msg.Success != nil && *msg.Success, err: msg.Error}:
+	default:
+	}
+}
+
+// streamBook converts the order book data of the orderbook table.
+func streamBook(r OrderbookReturn, delta bool) Book {
+	var bid, ask []OrderBookItem
+	for _, d := range r.Data {
+		item := OrderBookItem{Price: d.Price, Size: d.Size}
+		switch d.Side {
+		case BidSide:
+			bid = append(bid, item)
+		case AskSide:
+			ask = append(ask, item)
+		}
+	}
+	return newBook(r.Symbol, r.LastUpdateId, delta, bid, ask)
+}
+
+// resubscribe subscribes to every active topic on the current connection.
+// The commands are sent at once, their acknowledgements awaited without
+// holding back the other subscriptions.
+func (c *StreamClient) resubscribe() error {
+	c.subMu.Lock()
+	c.mu.Lock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	c.mu.Unlock()
+
+	var failed []string
+	sent := make([]pendingCommand, 0, len(topics))
+	for _, topic := range topics {
+		pending, err := c.send("subscribe", topic)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		sent = append(sent, pending)
+	}
+	c.subMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.CallTimeout)
+	defer cancel()
+	for _, pending := range sent {
+		if err := c.await(ctx, pending); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("resubscribe failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package spiral
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamServer speaks the streaming protocol, acknowledging every command
+// unless its hook answers otherwise.
+type streamServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	conns    []*websocket.Conn
+	commands []streamCommand
+	hook     func(cmd streamCommand) (ack bool, reply []byte) // may block
+
+	wmu sync.Mutex // serialises the writes of every connection
+}
+
+func newStreamServer(t *testing.T) *streamServer {
+	s := &streamServer{}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, ws)
+		s.mu.Unlock()
+		s.serve(ws)
+	}))
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *streamServer) serve(ws *websocket.Conn) {
+	for {
+		var cmd streamCommand
+		if err := ws.ReadJSON(&cmd); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		hook := s.hook
+		s.mu.Unlock()
+
+		// acknowledgements are sent in the background so a hook holding one
+		// back does not hold back the following commands
+		go func() {
+			ack, reply := true, []byte(nil)
+			if hook != nil {
+				ack, reply = hook(cmd)
+			}
+			s.wmu.Lock()
+			defer s.wmu.Unlock()
+			switch {
+			case reply != nil:
+				ws.WriteMessage(websocket.TextMessage, reply)
+			case ack:
+				for _, topic := range cmd.Args {
+					ws.WriteJSON(map[string]interface{}{"success": true, cmd.Op: topic, "request": cmd})
+				}
+			}
+		}()
+	}
+}
+
+func (s *streamServer) url() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// handle sets the hook answering the commands.
+func (s *streamServer) handle(hook func(cmd streamCommand) (ack bool, reply []byte)) {
+	s.mu.Lock()
+	s.hook = hook
+	s.mu.Unlock()
+}
+
+// send sends data on every connection.
+func (s *streamServer) send(data []byte) {
+	s.mu.Lock()
+	conns := append([]*websocket.Conn(nil), s.conns...)
+	s.mu.Unlock()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	for _, ws := range conns {
+		ws.WriteMessage(websocket.TextMessage, data)
+	}
+}
+
+// count returns the number of commands op received.
+func (s *streamServer) count(op string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, cmd := range s.commands {
+		if cmd.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+// disconnect closes every connection opened so far.
+func (s *streamServer) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ws := range s.conns {
+		ws.Close()
+	}
+}
+
+// stop closes the server and its connections.
+func (s *streamServer) stop() {
+	s.Close()
+	s.disconnect()
+}
+
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "stream", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// The fixtures of testdata/stream pin the messages StreamClient decodes,
+// they follow the examples of streamMessage.
+func TestStreamFixtures(t *testing.T) {
+	server := newStreamServer(t)
+	rejected, acknowledged := fixture(t, "subscribe_error.json"), fixture(t, "subscribe_ack.json")
+	server.handle(func(cmd streamCommand) (bool, []byte) {
+		switch cmd.Args[0] {
+		case "orderbook:NOPE":
+			return false, rejected
+		case "orderbook:BTCUSDT":
+			return false, acknowledged
+		}
+		return true, nil
+	})
+	client, err := NewStreamClient(WSConfig{URL: server.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.StreamBook("NOPE"); err == nil || !strings.Contains(err.Error(), "unknown topic: orderbook:NOPE") {
+		t.Errorf("rejected subscription = %v", err)
+	}
+	book, err := client.StreamBook("BTCUSDT", FeedOptions{Buffer: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades, err := client.StreamTrades("BTCUSDT", FeedOptions{Buffer: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles, err := client.StreamCandles("BTCUSDT", Period1Minute, FeedOptions{Buffer: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"orderbook_partial.json", "orderbook_update.json", "trades_insert.json", "candles_update.json"} {
+		server.send(fixture(t, name))
+	}
+
+	partial, update := <-book.Updates, <-book.Updates
+	if partial.Delta || partial.Sequence != 100 || len(partial.Bid) != 2 || partial.Bid[0] != (OrderBookItem{9000.5, 1.5}) ||
+		len(partial.Ask) != 1 || partial.Ask[0] != (OrderBookItem{9001, 0.25}) {
+		t.Errorf("partial = %+v", partial)
+	}
+	if !update.Delta || update.Sequence != 101 || len(update.Bid) != 1 || update.Bid[0] != (OrderBookItem{8999, 0}) ||
+		len(update.Ask) != 1 || update.Ask[0] != (OrderBookItem{9001.5, 1}) {
+		t.Errorf("update = %+v", update)
+	}
+
+	trade := <-trades.Updates
+	want := MarketTrade{ID: 7, Symbol: "BTCUSDT", Side: BidSide, Price: 9000.5, Quantity: 0.1, Time: time.Unix(1546300800, 0)}
+	if trade.ID != want.ID || trade.Symbol != want.Symbol || trade.Side != want.Side || trade.Price != want.Price ||
+		trade.Quantity != want.Quantity || !trade.Time.Equal(want.Time) {
+		t.Errorf("trade = %+v", trade)
+	}
+	select {
+	case trade := <-trades.Updates:
+		t.Errorf("trade of another symbol delivered: %+v", trade)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	candle := <-candles.Updates
+	if candle.Symbol != "BTCUSDT" || candle.Period != Period1Minute || !candle.OpenTime.Equal(time.Unix(1546300800, 0)) ||
+		candle.Open != 9000 || candle.High != 9010 || candle.Low != 8990 || candle.Close != 9005 || candle.Volume != 12.5 || candle.Trades != 42 {
+		t.Errorf("candle = %+v", candle)
+	}
+}
+
+// Acknowledgements awaited after a reconnection must not hold back new
+// subscriptions.
+func TestStreamClientResubscribeConcurrently(t *testing.T) {
+	server := newStreamServer(t)
+	client, err := NewStreamClient(WSConfig{URL: server.url(), CallTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, symbol := range []string{"A", "B"} {
+		if _, err := client.StreamBook(symbol); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hold := make(chan struct{})
+	defer close(hold)
+	server.handle(func(cmd streamCommand) (bool, []byte) {
+		if strings.HasPrefix(cmd.Args[0], "orderbook:") {
+			<-hold
+		}
+		return true, nil
+	})
+	server.disconnect()
+	// both topics are sent again at once, before any acknowledgement
+	eventually(t, "resubscription", func() bool { return server.count("subscribe") == 4 })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.StreamTrades("A")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("subscription held back by the pending resubscription")
+	}
+}
+
+// Commands sent again for a topic before the previous one is acknowledged
+// each get an acknowledgement.
+func TestStreamClientSameTopicCommands(t *testing.T) {
+	server := newStreamServer(t)
+	client, err := NewStreamClient(WSConfig{URL: server.url(), CallTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	hold := make(chan struct{})
+	server.handle(func(cmd streamCommand) (bool, []byte) {
+		<-hold
+		return true, nil
+	})
+	var sent []pendingCommand
+	for i := 0; i < 3; i++ {
+		pending, err := client.send("subscribe", "orderbook:A")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, pending)
+	}
+	eventually(t, "commands", func() bool { return server.count("subscribe") == 3 })
+
+	// the second one gives up before the acknowledgements
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.await(expired, sent[1]); err == nil {
+		t.Error("expired command acknowledged")
+	}
+	close(hold)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, i := range []int{0, 2} {
+		if err := client.await(ctx, sent[i]); err != nil {
+			t.Errorf("command %d: %v", i, err)
+		}
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.acks) != 0 {
+		t.Errorf("pending commands left: %v", client.acks)
+	}
+}
+
+func TestCandleFeedCountsUnconverted(t *testing.T) {
+	f := candleFeed("candles:BTCUSDT:H2", FeedOptions{Buffer: 4})
+	go f.run()
+	defer f.close()
+
+	// H2 has no kline period
+	f.push(WSNotificationCandlesUpdate{Symbol: "BTCUSDT", Period: interval("H2")})
+	f.push(WSNotificationCandlesUpdate{Symbol: "BTCUSDT", Period: Interval1Minute, Data: WSCandles{Timestamp: Timestamp{time.Unix(60, 0)}}})
+	if c := <-f.updates.(<-chan Candle); c.Period != Period1Minute {
+		t.Errorf("candle = %+v", c)
+	}
+	if n := f.stats().Dropped; n != 1 {
+		t.Errorf("dropped %d, want 1", n)
+	}
+}
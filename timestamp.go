@@ -0,0 +1,105 @@
+package spiral
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timestamp is a point in time sent by the API.
+//
+// It decodes epoch seconds, milliseconds, microseconds or nanoseconds, either
+// as JSON numbers or numeric strings, as well as RFC3339 strings. The unit of
+// epoch values is inferred from their magnitude.
+type Timestamp struct {
+	time.Time
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Timestamp) UnmarshalJSON(bs []byte) error {
+	bs = bytes.TrimSpace(bs)
+	if bytes.Equal(bs, []byte("null")) {
+		*t = Timestamp{}
+		return nil
+	}
+
+	s := string(bs)
+	if len(bs) > 0 && bs[0] == '"' {
+		if err := json.Unmarshal(bs, &s); err != nil {
+			return err
+		}
+	}
+	ts, err := parseTimestamp(s)
+	if err != nil {
+		return err
+	}
+	*t = ts
+	return nil
+}
+
+// MarshalJSON encodes the timestamp as an RFC3339 string, or null when zero.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.UTC().Format(time.RFC3339Nano))
+}
+
+// parseTimestamp parses an epoch value or an RFC3339 string.
+func parseTimestamp(s string) (Timestamp, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Timestamp{}, nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Timestamp{epochTime(n)}, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) >= math.MaxInt64 {
+			return Timestamp{}, fmt.Errorf("spiral: timestamp %q out of range", s)
+		}
+		// fractional values are only sent as seconds
+		if math.Abs(f) < 1e11 {
+			sec, frac := math.Modf(f)
+			return Timestamp{time.Unix(int64(sec), int64(frac*1e9)).UTC()}, nil
+		}
+		return Timestamp{epochTime(int64(f))}, nil
+	}
+
+	tm, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("spiral: cannot parse timestamp %q", s)
+	}
+	return Timestamp{tm}, nil
+}
+
+// epochTime converts an epoch value to time, guessing its unit from its magnitude.
+func epochTime(n int64) time.Time {
+	abs := n
+	if abs < 0 {
+		abs = -abs // math.MinInt64 stays negative and is read as nanoseconds
+	}
+	switch {
+	case abs < 0:
+		return time.Unix(0, n).UTC()
+	case abs < 1e11: // seconds, until year 5138
+		return time.Unix(n, 0).UTC()
+	case abs < 1e14: // milliseconds
+		return time.UnixMilli(n).UTC()
+	case abs < 1e17: // microseconds
+		return time.UnixMicro(n).UTC()
+	default: // nanoseconds
+		return time.Unix(0, n).UTC()
+	}
+}
+
+// timeParam formats t as the epoch milliseconds expected by request
+// parameters, as pinned by the klines fixture of testdata/replay.
+func timeParam(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
@@ -0,0 +1,81 @@
+package spiral
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEpochTime(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want time.Time
+	}{
+		{1546300800, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{-1546300800, time.Date(1921, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{1546300800123, time.Date(2019, 1, 1, 0, 0, 0, 123e6, time.UTC)},
+		{1546300800123456, time.Date(2019, 1, 1, 0, 0, 0, 123456e3, time.UTC)},
+		{1546300800123456789, time.Date(2019, 1, 1, 0, 0, 0, 123456789, time.UTC)},
+		// milliseconds and microseconds past 2262 overflow when counted in nanoseconds
+		{99999999999999, time.Date(5138, 11, 16, 9, 46, 39, 999e6, time.UTC)},
+		{-99999999999999, time.Date(-1199, 2, 15, 14, 13, 20, 1e6, time.UTC)},
+		{99999999999999999, time.Date(5138, 11, 16, 9, 46, 39, 999999e3, time.UTC)},
+		{math.MinInt64, time.Unix(0, math.MinInt64).UTC()},
+	}
+	for _, tt := range tests {
+		if got := epochTime(tt.n); !got.Equal(tt.want) {
+			t.Errorf("epochTime(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestTimestampUnmarshal(t *testing.T) {
+	var v struct {
+		A, B, C, D Timestamp
+	}
+	in := `{"A": 1546300800, "B": "1546300800123", "C": "2019-01-01T00:00:00.5Z", "D": null}`
+	if err := json.Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A.Unix() != 1546300800 || v.B.UnixMilli() != 1546300800123 || v.C.Nanosecond() != 5e8 || !v.D.IsZero() {
+		t.Errorf("timestamps = %+v", v)
+	}
+
+	for _, in := range []string{`"yesterday"`, `1e300`, `"NaN"`, `true`} {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(in), &ts); err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want an error", in, ts)
+		}
+	}
+}
+
+func TestTimeParam(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2019, 1, 1, 0, 0, 0, 999999, time.UTC), "1546300800000"},
+		{time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), "-1000"},
+		{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), "32503680000000"},
+	}
+	for _, tt := range tests {
+		if got := timeParam(tt.t); got != tt.want {
+			t.Errorf("timeParam(%v) = %s, want %s", tt.t, got, tt.want)
+		}
+	}
+}
+
+// The klines fixture only matches when the range is sent in milliseconds.
+func TestKLinesInRangeSendsMilliseconds(t *testing.T) {
+	api := newReplayAPI(t, "testdata/replay")
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	klines, err := api.GetKLinesInRange("BTCUSDT", Period1Minute, start, start.Add(4*time.Minute-time.Millisecond), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(klines) != 2 || !klines[0].OpenTs.Equal(start) || klines[1].NumberOfTrade != 7 {
+		t.Errorf("klines = %+v", klines)
+	}
+}
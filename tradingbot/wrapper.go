@@ -0,0 +1,445 @@
+// Package tradingbot adapts the spiral clients to the exchange wrapper of
+// golang-crypto-trading-bot, so the bot can trade on Spiral, or on any other
+// spiral.Exchange such as the hitbtc package.
+//
+// Markets are mapped to exchange symbols by Wrapper.Symbol, amounts are
+// rounded to the increments of the symbol and every number is converted
+// between the float64 of the spiral models and the decimals of the bot.
+package tradingbot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/saniales/golang-crypto-trading-bot/exchanges"
+	"github.com/shopspring/decimal"
+	spiral "github.com/snakehopper/go-spiral"
+)
+
+const (
+	wrapperName    = "spiral"
+	candleLimit    = 100 // default number of candles returned by GetCandles
+	orderbookDepth = 100 // default number of levels returned by GetOrderBook
+)
+
+// ErrWithdrawUnsupported is returned by Withdraw, the Spiral API having no
+// withdrawal endpoint.
+var ErrWithdrawUnsupported = errors.New("tradingbot: withdrawals are not supported")
+
+// Config configures a Wrapper. Zero fields take their default value.
+type Config struct {
+	Name             string            // exchange name in the bot configuration, spiral by default
+	DepositAddresses map[string]string // deposit address of each coin ticker
+	CandlePeriod     spiral.Period     // period of the candles returned by GetCandles, 30 minutes by default
+	CandleLimit      int               // candles returned by GetCandles, 100 by default
+	OrderbookDepth   int               // levels returned by GetOrderBook, 100 by default
+	TakerFee         float64           // fee rate of taker trades, ie. 0.001 for 0.1%
+	MakerFee         float64           // fee rate of maker trades
+}
+
+// Wrapper implements exchanges.ExchangeWrapper on top of a spiral.Exchange,
+// with market summaries streamed by a WSClient once FeedConnect is called.
+type Wrapper struct {
+	api    spiral.Exchange
+	config Config
+
+	mu         sync.Mutex
+	ws         *spiral.WSClient
+	ownsWS     bool // the client was connected by FeedConnect
+	tickers    map[string]*spiral.TickerSubscription
+	summaries  map[string]environment.MarketSummary // latest summary of each streamed symbol
+	symbols    map[string]spiral.Symbol
+	currencies map[string]spiral.Currency
+}
+
+var _ exchanges.ExchangeWrapper = (*Wrapper)(nil)
+
+// NewSpiralWrapper returns a wrapper of the Spiral API, like the wrapper
+// constructors of the bot.
+func NewSpiralWrapper(publicKey string, secretKey string, depositAddresses map[string]string) *Wrapper {
+	return New(spiral.New(publicKey, secretKey), nil, Config{DepositAddresses: depositAddresses})
+}
+
+// New returns a wrapper of api. Market summaries are streamed by ws, or by a
+// client connected by FeedConnect when ws is nil.
+func New(api spiral.Exchange, ws *spiral.WSClient, cfg Config) *Wrapper {
+	if cfg.Name == "" {
+		cfg.Name = wrapperName
+	}
+	if cfg.CandlePeriod == "" {
+		cfg.CandlePeriod = spiral.Period30Minutes
+	}
+	if cfg.CandleLimit <= 0 {
+		cfg.CandleLimit = candleLimit
+	}
+	if cfg.OrderbookDepth <= 0 {
+		cfg.OrderbookDepth = orderbookDepth
+	}
+	return &Wrapper{
+		api:       api,
+		config:    cfg,
+		ws:        ws,
+		tickers:   make(map[string]*spiral.TickerSubscription),
+		summaries: make(map[string]environment.MarketSummary),
+	}
+}
+
+// Name returns the name of the exchange in the bot configuration.
+func (w *Wrapper) Name() string {
+	return w.config.Name
+}
+
+// Symbol returns the exchange symbol of market: its name for this exchange
+// in the bot configuration, else the market currency followed by the base
+// currency, ie. ETHBTC for the BTC-ETH market.
+func (w *Wrapper) Symbol(market *environment.Market) string {
+	if name := exchanges.MarketNameFor(market, w); name != "" {
+		return name
+	}
+	return strings.ToUpper(market.MarketCurrency + market.BaseCurrency)
+}
+
+// GetCandles returns the latest candles of market.
+func (w *Wrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+	klines, err := w.api.GetKLines(w.Symbol(market), w.config.CandlePeriod, w.config.CandleLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]environment.CandleStick, len(klines))
+	for i, k := range klines {
+		candles[i] = environment.CandleStick{
+			High:   decimal.NewFromFloat(k.High),
+			Open:   decimal.NewFromFloat(k.Open),
+			Close:  decimal.NewFromFloat(k.Close),
+			Low:    decimal.NewFromFloat(k.Low),
+			Volume: decimal.NewFromFloat(k.Vol),
+		}
+	}
+	return candles, nil
+}
+
+// GetMarketSummary returns the summary of market, streamed if its feed is
+// subscribed and else built from the daily kline and the best levels of the
+// order book.
+func (w *Wrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	symbol := w.Symbol(market)
+	w.mu.Lock()
+	summary, ok := w.summaries[symbol]
+	w.mu.Unlock()
+	if ok {
+		return &summary, nil
+	}
+
+	klines, err := w.api.GetKLines(symbol, spiral.Period1Day, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(klines) == 0 {
+		return nil, fmt.Errorf("tradingbot: no daily kline for %s", symbol)
+	}
+	book, err := w.api.GetOrderbook(symbol, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(book.Ask) == 0 || len(book.Bid) == 0 {
+		return nil, fmt.Errorf("tradingbot: empty order book for %s", symbol)
+	}
+
+	day := klines[len(klines)-1]
+	return &environment.MarketSummary{
+		High:   decimal.NewFromFloat(day.High),
+		Low:    decimal.NewFromFloat(day.Low),
+		Volume: decimal.NewFromFloat(day.Vol),
+		Ask:    decimal.NewFromFloat(book.Ask[0].Price),
+		Bid:    decimal.NewFromFloat(book.Bid[0].Price),
+		Last:   decimal.NewFromFloat(day.Close),
+	}, nil
+}
+
+// GetOrderBook returns the order book of market, best levels first.
+func (w *Wrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	book, err := w.api.GetOrderbook(w.Symbol(market), w.config.OrderbookDepth)
+	if err != nil {
+		return nil, err
+	}
+	return &environment.OrderBook{
+		Asks: bookOrders(book.Ask),
+		Bids: bookOrders(book.Bid),
+	}, nil
+}
+
+func bookOrders(levels []spiral.OrderBookItem) []environment.Order {
+	orders := make([]environment.Order, len(levels))
+	for i, level := range levels {
+		orders[i] = environment.Order{
+			Value:    decimal.NewFromFloat(level.Price),
+			Quantity: decimal.NewFromFloat(level.Size),
+		}
+	}
+	return orders
+}
+
+// BuyLimit places a limit buy order, returning the id of the order.
+func (w *Wrapper) BuyLimit(market *environment.Market, amount float64, limit float64) (string, error) {
+	return w.placeOrder(market, spiral.Orders{Side: spiral.BidSide, Type: spiral.LimitOrderType, Quantity: amount, Price: limit})
+}
+
+// SellLimit places a limit sell order, returning the id of the order.
+func (w *Wrapper) SellLimit(market *environment.Market, amount float64, limit float64) (string, error) {
+	return w.placeOrder(market, spiral.Orders{Side: spiral.AskSide, Type: spiral.LimitOrderType, Quantity: amount, Price: limit})
+}
+
+// BuyMarket places a market buy order, returning the id of the order.
+func (w *Wrapper) BuyMarket(market *environment.Market, amount float64) (string, error) {
+	return w.placeOrder(market, spiral.Orders{Side: spiral.BidSide, Type: spiral.MarketOrderType, Quantity: amount})
+}
+
+// SellMarket places a market sell order, returning the id of the order.
+func (w *Wrapper) SellMarket(market *environment.Market, amount float64) (string, error) {
+	return w.placeOrder(market, spiral.Orders{Side: spiral.AskSide, Type: spiral.MarketOrderType, Quantity: amount})
+}
+
+// placeOrder places order on market once its quantity is rounded down to the
+// trade increment and its price to the tick size of the symbol.
+func (w *Wrapper) placeOrder(market *environment.Market, order spiral.Orders) (string, error) {
+	order.Symbol = w.Symbol(market)
+	symbol, err := w.symbol(order.Symbol)
+	if err != nil {
+		return "", err
+	}
+	order.Quantity = roundDown(order.Quantity, symbol.MinTrade)
+	if order.Quantity <= 0 {
+		return "", fmt.Errorf("tradingbot: amount below the %v increment of %s", symbol.MinTrade, order.Symbol)
+	}
+	if order.Type == spiral.LimitOrderType {
+		order.Price = roundNearest(order.Price, symbol.TickSize)
+	}
+
+	resp, err := w.api.PlaceOrder(order)
+	if err != nil {
+		return "", err
+	}
+	if resp.Order.Id == 0 {
+		return resp.Order.ClientOrderId, nil
+	}
+	return strconv.FormatInt(resp.Order.Id, 10), nil
+}
+
+// roundDown returns f rounded down to a multiple of step, f itself when step
+// is 0.
+func roundDown(f, step float64) float64 {
+	if step <= 0 {
+		return f
+	}
+	s := decimal.NewFromFloat(step)
+	r, _ := decimal.NewFromFloat(f).Div(s).Floor().Mul(s).Float64()
+	return r
+}
+
+// roundNearest returns f rounded to the nearest multiple of step, f itself
+// when step is 0.
+func roundNearest(f, step float64) float64 {
+	if step <= 0 {
+		return f
+	}
+	s := decimal.NewFromFloat(step)
+	r, _ := decimal.NewFromFloat(f).Div(s).Round(0).Mul(s).Float64()
+	return r
+}
+
+// CalculateTradingFees returns the fees of trading amount at the limit
+// price, in the base currency of market.
+func (w *Wrapper) CalculateTradingFees(market *environment.Market, amount float64, limit float64, orderType exchanges.TradeType) float64 {
+	rate := w.config.TakerFee
+	if orderType == exchanges.MakerTrade {
+		rate = w.config.MakerFee
+	}
+	return amount * limit * rate
+}
+
+// CalculateWithdrawFees returns the fee of withdrawing the market currency of
+// market, 0 when it is unknown.
+func (w *Wrapper) CalculateWithdrawFees(market *environment.Market, amount float64) float64 {
+	currency, err := w.currency(market.MarketCurrency)
+	if err != nil {
+		return 0
+	}
+	return currency.WithdrawalFee
+}
+
+// GetBalance returns the available balance of the coin symbol.
+func (w *Wrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	balance, err := w.api.GetBalance(symbol)
+	if err != nil {
+		return nil, err
+	}
+	available := decimal.NewFromFloat(balance.Available)
+	return &available, nil
+}
+
+// GetDepositAddress returns the deposit address of coinTicker set in Config.
+func (w *Wrapper) GetDepositAddress(coinTicker string) (string, bool) {
+	address, ok := w.config.DepositAddresses[coinTicker]
+	return address, ok
+}
+
+// FeedConnect connects the WebSocket client, unless New was given one, and
+// subscribes to the summary feed of markets.
+func (w *Wrapper) FeedConnect(markets []*environment.Market) error {
+	w.mu.Lock()
+	if w.ws == nil {
+		ws, err := spiral.NewWSClient()
+		if err != nil {
+			w.mu.Unlock()
+			return err
+		}
+		w.ws, w.ownsWS = ws, true
+	}
+	w.mu.Unlock()
+
+	for _, market := range markets {
+		if err := w.SubscribeMarketSummaryFeed(market); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubscribeMarketSummaryFeed streams the ticker of market into the summaries
+// returned by GetMarketSummary.
+func (w *Wrapper) SubscribeMarketSummaryFeed(market *environment.Market) error {
+	symbol := w.Symbol(market)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ws == nil {
+		return errors.New("tradingbot: feed not connected, call FeedConnect first")
+	}
+	if _, ok := w.tickers[symbol]; ok {
+		return nil
+	}
+	ticker, err := w.ws.SubscribeTicker(symbol, spiral.FeedOptions{Buffer: 1, Policy: spiral.ConflatePolicy})
+	if err != nil {
+		return err
+	}
+	w.tickers[symbol] = ticker
+
+	go func() {
+		for t := range ticker.Updates {
+			summary := environment.MarketSummary{
+				High:   wsDecimal(t.High),
+				Low:    wsDecimal(t.Low),
+				Volume: wsDecimal(t.Volume),
+				Ask:    wsDecimal(t.Ask),
+				Bid:    wsDecimal(t.Bid),
+				Last:   wsDecimal(t.Last),
+			}
+			w.mu.Lock()
+			if w.tickers[symbol] == ticker {
+				w.summaries[symbol] = summary
+			}
+			w.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// UnsubscribeMarketSummaryFeed stops streaming the ticker of market.
+func (w *Wrapper) UnsubscribeMarketSummaryFeed(market *environment.Market) {
+	symbol := w.Symbol(market)
+
+	w.mu.Lock()
+	ticker, ok := w.tickers[symbol]
+	delete(w.tickers, symbol)
+	delete(w.summaries, symbol)
+	w.mu.Unlock()
+
+	if ok {
+		ticker.Close()
+	}
+}
+
+// Withdraw returns ErrWithdrawUnsupported.
+func (w *Wrapper) Withdraw(destinationAddress string, coinTicker string, amount float64) error {
+	return ErrWithdrawUnsupported
+}
+
+// Close stops every summary feed, closing the WebSocket client if it was
+// connected by FeedConnect.
+func (w *Wrapper) Close() {
+	w.mu.Lock()
+	tickers := w.tickers
+	w.tickers = make(map[string]*spiral.TickerSubscription)
+	w.summaries = make(map[string]environment.MarketSummary)
+	ws := w.ws
+	if w.ownsWS {
+		w.ws, w.ownsWS = nil, false
+	} else {
+		ws = nil
+	}
+	w.mu.Unlock()
+
+	for _, ticker := range tickers {
+		ticker.Close()
+	}
+	if ws != nil {
+		ws.Close()
+	}
+}
+
+// wsDecimal converts a decimal of the WebSocket API exactly, absent values
+// being zero.
+func wsDecimal(d spiral.Decimal) decimal.Decimal {
+	r, err := decimal.NewFromString(d.String())
+	if err != nil {
+		return decimal.Zero
+	}
+	return r
+}
+
+// symbol returns the trading rules of the exchange symbol, fetched once.
+func (w *Wrapper) symbol(name string) (spiral.Symbol, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.symbols == nil {
+		symbols, err := w.api.GetSymbols()
+		if err != nil {
+			return spiral.Symbol{}, err
+		}
+		w.symbols = make(map[string]spiral.Symbol, len(symbols))
+		for _, s := range symbols {
+			w.symbols[s.Symbol] = s
+		}
+	}
+	s, ok := w.symbols[name]
+	if !ok {
+		return spiral.Symbol{}, fmt.Errorf("tradingbot: unknown symbol %s", name)
+	}
+	return s, nil
+}
+
+// currency returns the currency code, fetched once.
+func (w *Wrapper) currency(code string) (spiral.Currency, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.currencies == nil {
+		currencies, err := w.api.GetCurrencies()
+		if err != nil {
+			return spiral.Currency{}, err
+		}
+		w.currencies = make(map[string]spiral.Currency, len(currencies))
+		for _, c := range currencies {
+			w.currencies[c.Code] = c
+		}
+	}
+	c, ok := w.currencies[strings.ToUpper(code)]
+	if !ok {
+		return spiral.Currency{}, fmt.Errorf("tradingbot: unknown currency %s", code)
+	}
+	return c, nil
+}
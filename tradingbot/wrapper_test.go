@@ -0,0 +1,290 @@
+package tradingbot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/saniales/golang-crypto-trading-bot/environment"
+	"github.com/saniales/golang-crypto-trading-bot/exchanges"
+	spiral "github.com/snakehopper/go-spiral"
+)
+
+// rewriteHost sends every request to the host of base.
+type rewriteHost struct {
+	base *url.URL
+}
+
+func (r rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = r.base.Scheme
+	req.URL.Host = r.base.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+var responses = map[string]string{
+	"products":        `{"data":[{"symbol":"ETHBTC","base_asset":"ETH","quote_asset":"BTC","tick_size":"0.0001","min_trade":"0.01"}]}`,
+	"currencies":      `{"data":[{"code":"ETH","withdrawal_fee":"0.005"}]}`,
+	"klines":          `{"data":[[1546300800000,"1","2","0.5","1.5","10",1546304399999,"",3],[1546304400000,"1.5","3","1.2","2.5","5",1546307999999,"",2]]}`,
+	"orderbook":       `{"symbol":"ETHBTC","data":[["0.030","4","bid"],["0.031","2","bid"],["0.032","1","ask"],["0.033","3","ask"]]}`,
+	"wallet/balances": `{"data":[{"currency":"ETH","available":"1.25","locked":"0.5"}]}`,
+	"order":           `{"order":{"id":42,"clt_ord_id":"bot-1"}}`,
+}
+
+// spiralServer answers the REST requests of a Spiral client with responses,
+// recording the last order placed.
+type spiralServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	query  url.Values
+	placed map[string]string
+}
+
+func newSpiralServer(t *testing.T) (*spiralServer, *spiral.Spiral) {
+	s := &spiralServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+		s.mu.Lock()
+		s.query = r.URL.Query()
+		if r.Method == "POST" && resource == "order" {
+			body, _ := ioutil.ReadAll(r.Body)
+			s.placed = nil
+			json.Unmarshal(body, &s.placed)
+		}
+		s.mu.Unlock()
+		w.Write([]byte(responses[resource]))
+	}))
+	t.Cleanup(s.Close)
+	base, _ := url.Parse(s.URL)
+	return s, spiral.NewWithCustomHttpClient("key", "secret", &http.Client{Transport: rewriteHost{base}})
+}
+
+func (s *spiralServer) lastQuery() url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.query
+}
+
+func (s *spiralServer) lastOrder() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.placed
+}
+
+// newTickerServer returns the URL of a WebSocket server acknowledging every
+// call and sending a ticker of ETHBTC after each subscribeTicker.
+func newTickerServer(t *testing.T) string {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req struct {
+				ID     *json.RawMessage `json:"id"`
+				Method string           `json:"method"`
+			}
+			if conn.ReadJSON(&req) != nil {
+				return
+			}
+			conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": true})
+			if req.Method == "subscribeTicker" {
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "method": "ticker", "params": map[string]string{
+					"symbol": "ETHBTC", "ask": "0.0321", "bid": "0.032", "last": "0.03205", "high": "0.04", "low": "0.03", "volume": "100.5",
+				}})
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// emptyBook is an exchange whose order books are empty.
+type emptyBook struct {
+	spiral.Exchange
+}
+
+func (emptyBook) GetOrderbook(market string, limit int) (spiral.Orderbook, error) {
+	return spiral.Orderbook{}, nil
+}
+
+var ethbtc = &environment.Market{Name: "BTC-ETH", BaseCurrency: "BTC", MarketCurrency: "ETH"}
+
+func TestSymbol(t *testing.T) {
+	w := New(nil, nil, Config{})
+	if s := w.Symbol(ethbtc); s != "ETHBTC" {
+		t.Errorf("Symbol = %s, want ETHBTC", s)
+	}
+	named := &environment.Market{Name: "BTC-ETH", ExchangeNames: map[string]string{"spiral": "ETH-BTC"}}
+	if s := w.Symbol(named); s != "ETH-BTC" {
+		t.Errorf("Symbol of a named market = %s, want ETH-BTC", s)
+	}
+}
+
+func TestGetCandles(t *testing.T) {
+	server, api := newSpiralServer(t)
+	w := New(api, nil, Config{CandleLimit: 2})
+
+	candles, err := w.GetCandles(ethbtc)
+	if err != nil || len(candles) != 2 {
+		t.Fatal(candles, err)
+	}
+	if q := server.lastQuery(); q.Get("symbol") != "ETHBTC" || q.Get("limit") != "2" || q.Get("period") != string(spiral.Period30Minutes) {
+		t.Errorf("klines query = %v", q)
+	}
+	if c := candles[1]; c.Open.String() != "1.5" || c.High.String() != "3" || c.Low.String() != "1.2" || c.Close.String() != "2.5" || c.Volume.String() != "5" {
+		t.Errorf("candle = %+v", c)
+	}
+}
+
+func TestGetOrderBook(t *testing.T) {
+	_, api := newSpiralServer(t)
+	w := New(api, nil, Config{})
+
+	book, err := w.GetOrderBook(ethbtc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Bids) != 2 || book.Bids[0].Value.String() != "0.031" || book.Bids[0].Quantity.String() != "2" {
+		t.Errorf("bids = %+v", book.Bids)
+	}
+	if len(book.Asks) != 2 || book.Asks[0].Value.String() != "0.032" {
+		t.Errorf("asks = %+v", book.Asks)
+	}
+}
+
+func TestGetMarketSummary(t *testing.T) {
+	_, api := newSpiralServer(t)
+	w := New(api, nil, Config{})
+
+	summary, err := w.GetMarketSummary(ethbtc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.High.String() != "3" || summary.Low.String() != "1.2" || summary.Volume.String() != "5" ||
+		summary.Ask.String() != "0.032" || summary.Bid.String() != "0.031" || summary.Last.String() != "2.5" {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	if _, err := New(emptyBook{api}, nil, Config{}).GetMarketSummary(ethbtc); err == nil {
+		t.Error("GetMarketSummary of an empty order book succeeded")
+	}
+}
+
+func TestMarketSummaryFeed(t *testing.T) {
+	_, api := newSpiralServer(t)
+	ws, err := spiral.NewWSClientWithConfig(spiral.WSConfig{URL: newTickerServer(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	w := New(api, ws, Config{})
+	defer w.Close()
+
+	if err := w.FeedConnect([]*environment.Market{ethbtc}); err != nil {
+		t.Fatal(err)
+	}
+	var summary *environment.MarketSummary
+	deadline := time.Now().Add(5 * time.Second)
+	for summary == nil || summary.Last.String() != "0.03205" {
+		if time.Now().After(deadline) {
+			t.Fatalf("streamed summary = %+v", summary)
+		}
+		time.Sleep(5 * time.Millisecond)
+		summary, _ = w.GetMarketSummary(ethbtc)
+	}
+	if summary.Ask.String() != "0.0321" || summary.Volume.String() != "100.5" {
+		t.Errorf("streamed summary = %+v", summary)
+	}
+
+	w.UnsubscribeMarketSummaryFeed(ethbtc)
+	if summary, err = w.GetMarketSummary(ethbtc); err != nil || summary.Last.String() != "2.5" {
+		t.Errorf("summary after unsubscribing = %+v, %v", summary, err)
+	}
+}
+
+func TestSubscribeBeforeFeedConnect(t *testing.T) {
+	if err := New(nil, nil, Config{}).SubscribeMarketSummaryFeed(ethbtc); err == nil {
+		t.Error("SubscribeMarketSummaryFeed before FeedConnect succeeded")
+	}
+}
+
+func TestGetBalance(t *testing.T) {
+	_, api := newSpiralServer(t)
+	w := New(api, nil, Config{})
+
+	balance, err := w.GetBalance("ETH")
+	if err != nil || balance.String() != "1.25" {
+		t.Errorf("balance = %v, %v", balance, err)
+	}
+}
+
+func TestPlaceOrders(t *testing.T) {
+	server, api := newSpiralServer(t)
+	w := New(api, nil, Config{})
+
+	for _, c := range []struct {
+		place    func() (string, error)
+		side     string
+		typ      string
+		quantity string
+		price    string
+	}{
+		{func() (string, error) { return w.BuyLimit(ethbtc, 1.23456, 0.031249) }, "bid", "limit", "1.23000000", "0.03120000"},
+		{func() (string, error) { return w.SellLimit(ethbtc, 2, 0.03215) }, "ask", "limit", "2.00000000", "0.03220000"},
+		{func() (string, error) { return w.BuyMarket(ethbtc, 0.019) }, "bid", "market", "0.01000000", "0.00000000"},
+		{func() (string, error) { return w.SellMarket(ethbtc, 1) }, "ask", "market", "1.00000000", "0.00000000"},
+	} {
+		id, err := c.place()
+		if err != nil || id != "42" {
+			t.Errorf("%s %s order = %s, %v", c.typ, c.side, id, err)
+			continue
+		}
+		o := server.lastOrder()
+		if o["symbol"] != "ETHBTC" || o["side"] != c.side || o["type"] != c.typ || o["quantity"] != c.quantity || o["price"] != c.price {
+			t.Errorf("%s %s order sent %v", c.typ, c.side, o)
+		}
+	}
+
+	if _, err := w.SellMarket(ethbtc, 0.001); err == nil {
+		t.Error("order below the trade increment succeeded")
+	}
+}
+
+func TestFees(t *testing.T) {
+	_, api := newSpiralServer(t)
+	var w exchanges.ExchangeWrapper = New(api, nil, Config{TakerFee: 0.001, MakerFee: 0.0005})
+
+	if f := w.CalculateTradingFees(ethbtc, 2, 10, exchanges.TakerTrade); f != 0.02 {
+		t.Errorf("taker fees = %v, want 0.02", f)
+	}
+	if f := w.CalculateTradingFees(ethbtc, 2, 10, exchanges.MakerTrade); f != 0.01 {
+		t.Errorf("maker fees = %v, want 0.01", f)
+	}
+	if f := w.CalculateWithdrawFees(ethbtc, 1); f != 0.005 {
+		t.Errorf("withdraw fees = %v, want 0.005", f)
+	}
+}
+
+func TestDepositAndWithdraw(t *testing.T) {
+	w := New(nil, nil, Config{DepositAddresses: map[string]string{"ETH": "0xabc"}})
+
+	if address, ok := w.GetDepositAddress("ETH"); !ok || address != "0xabc" {
+		t.Errorf("ETH deposit address = %s, %v", address, ok)
+	}
+	if _, ok := w.GetDepositAddress("BTC"); ok {
+		t.Error("BTC has a deposit address")
+	}
+	if err := w.Withdraw("0xdef", "ETH", 1); err != ErrWithdrawUnsupported {
+		t.Errorf("Withdraw = %v", err)
+	}
+}
@@ -3,170 +3,252 @@ package spiral
 import (
 	"context"
 	"encoding/json"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/juju/errors"
 	"github.com/sourcegraph/jsonrpc2"
-	jsonrpc2ws "github.com/sourcegraph/jsonrpc2/websocket"
 )
 
-const wsAPIURL string = "wss://api.spiral.com/api/2/ws"
+const (
+	wsAPIURL    string = "wss://api.spiral.com/api/2/ws"
+	wsInboxSize int    = 1 << 16 // notifications waiting for dispatch before new ones are dropped and counted by their feeds
+)
 
 // responseChannels handles all incoming data from the spiral connection.
 type responseChannels struct {
-	notifications notificationChannels
-
-	OrderbookFeed map[string]chan WSNotificationOrderbookSnapshot
-	TradesFeed    map[string]chan WSNotificationTradesSnapshot
-	CandlesFeed   map[string]chan WSNotificationCandlesSnapshot
+	feeds *feedRegistry
+	inbox *feedQueue
 
 	ErrorFeed chan error
 }
 
-// notificationChannels contains all the notifications from spiral for subscribed feeds.
-type notificationChannels struct {
-	TickerFeed    map[string]chan WSNotificationTickerResponse
-	OrderbookFeed map[string]chan WSNotificationOrderbookUpdate
-	TradesFeed    map[string]chan WSNotificationTradesUpdate
-	CandlesFeed   map[string]chan WSNotificationCandlesUpdate
+// notification is a decoded notification waiting to be dispatched to its feed.
+type notification struct {
+	key string
+	msg interface{}
 }
 
 // Handle handles all incoming connections and fills the channels properly.
+//
+// Notifications are queued in the order they are received and dispatched to
+// their feeds by a single goroutine, so order book sequences reach their feeds
+// in order and a blocked feed never prevents the connection from reading.
+// While wsInboxSize notifications wait for dispatch, new ones are dropped and
+// counted in the Dropped stats of every feed of their subscription.
 func (h *responseChannels) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
 	if req.Params != nil {
 		message := *req.Params
 		switch req.Method {
 		case "ticker":
 			var msg WSNotificationTickerResponse
-			err := json.Unmarshal(message, &msg)
-			if err != nil {
-				h.ErrorFeed <- err
-			} else {
-				h.notifications.TickerFeed[msg.Symbol] <- msg
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("ticker", msg.Symbol), msg)
 			}
 		case "snapshotOrderbook":
 			var msg WSNotificationOrderbookSnapshot
-			err := json.Unmarshal(message, &msg)
-			if err != nil {
-				h.ErrorFeed <- err
-			} else {
-				h.OrderbookFeed[msg.Symbol] <- msg
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("orderbook", msg.Symbol), msg)
 			}
 		case "updateOrderbook":
 			var msg WSNotificationOrderbookUpdate
-			err := json.Unmarshal(message, &msg)
-			if err != nil {
-				h.ErrorFeed <- err
-			} else {
-				h.notifications.OrderbookFeed[msg.Symbol] <- msg
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("orderbook", msg.Symbol), msg)
 			}
 		case "snapshotTrades":
 			var msg WSNotificationTradesSnapshot
-			err := json.Unmarshal(message, &msg)
-			if err != nil {
-				h.ErrorFeed <- err
-			} else {
-				h.TradesFeed[msg.Symbol] <- msg
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("trades", msg.Symbol), msg)
 			}
 		case "updateTrades":
 			var msg WSNotificationTradesUpdate
-			err := json.Unmarshal(message, &msg)
-			if err != nil {
-				h.ErrorFeed <- err
-			} else {
-				h.notifications.TradesFeed[msg.Symbol] <- msg
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("trades", msg.Symbol), msg)
 			}
 		case "snapshotCandles":
 			var msg WSNotificationCandlesSnapshot
-			err := json.Unmarshal(message, &msg)
-			if err != nil {
-				h.ErrorFeed <- err
-			} else {
-				h.CandlesFeed[msg.Symbol] <- msg
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("candles", msg.Symbol, string(msg.Period)), msg)
 			}
 		case "updateCandles":
 			var msg WSNotificationCandlesUpdate
-			err := json.Unmarshal(message, &msg)
-			if err != nil {
-				h.ErrorFeed <- err
-			} else {
-				h.notifications.CandlesFeed[msg.Symbol] <- msg
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("candles", msg.Symbol, string(msg.Period)), msg)
+			}
+		case "activeOrders":
+			var msg []WSOrderReport
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("reports"), msg)
 			}
+		case "report":
+			var msg WSOrderReport
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("reports"), msg)
+			}
+		case "balance":
+			var msg []WSBalance
+			if h.decode(req.Method, message, &msg) {
+				h.enqueue(subscriptionKey("balance"), msg)
+			}
+		}
+	}
+}
+
+// enqueue queues msg for the feeds of key, counting it as dropped by each of
+// them when the inbox is full.
+func (h *responseChannels) enqueue(key string, msg interface{}) {
+	if !h.inbox.push(notification{key, msg}, nil) {
+		h.feeds.drop(key)
+	}
+}
+
+// dispatch delivers the queued notifications to their feeds until done.
+func (h *responseChannels) dispatch(done <-chan struct{}) {
+	for {
+		item, ok := h.inbox.pop(done)
+		if !ok {
+			return
 		}
+		n := item.(notification)
+		h.feeds.dispatch(n.key, n.msg)
+	}
+}
+
+// decode unmarshals a notification, reporting failures on the ErrorFeed.
+func (h *responseChannels) decode(method string, message json.RawMessage, v interface{}) bool {
+	err := json.Unmarshal(message, v)
+	if err != nil {
+		h.reportError(errors.Annotatef(err, "Spiral %s notification", method))
+		return false
+	}
+	return true
+}
+
+// reportError sends err on the ErrorFeed. Errors are dropped when the
+// ErrorFeed is full so they never stall the feeds.
+func (h *responseChannels) reportError(err error) {
+	select {
+	case h.ErrorFeed <- err:
+	default:
 	}
 }
 
 // WSClient represents a JSON RPC v2 Connection over Websocket,
+//
+// The connection is supervised: when it drops, the client reconnects with an
+// exponential backoff and restores every active subscription, reporting each
+// step on ConnectionEvents.
 type WSClient struct {
-	conn    *jsonrpc2.Conn
-	updates *responseChannels
+	latency   int64 // round trip time in nanoseconds, first for atomic alignment
+	config    WSConfig
+	updates   *responseChannels
+	ownsFeeds bool // false when the feeds are shared within a WSPool
+
+	*supervisor
+
+	subMu    sync.Mutex             // serialises the first and last references of subscriptions
+	requests map[string]feedRequest // open feeds by key, guarded by subMu
+
+	mu            sync.Mutex
+	conn          *jsonrpc2.Conn
+	subscriptions map[string]wsSubscription
+	credentials   *wsCredentials // logged in again before the subscriptions
 }
 
+// ErrWSClientClosed is the termination cause of a WSClient closed by Close.
+var ErrWSClientClosed = errors.New("Spiral websocket client closed")
+
 // NewWSClient creates a new WSClient
 func NewWSClient() (*WSClient, error) {
-	conn, _, err := websocket.DefaultDialer.Dial(wsAPIURL, nil)
+	return NewWSClientWithConfig(WSConfig{})
+}
+
+// NewWSClientWithConfig creates a new WSClient connected as set by cfg.
+func NewWSClientWithConfig(cfg WSConfig) (*WSClient, error) {
+	cfg, err := cfg.withDefaults()
 	if err != nil {
 		return nil, err
 	}
 
-	handler := responseChannels{
-		notifications: notificationChannels{
-			TickerFeed:    make(map[string]chan WSNotificationTickerResponse),
-			OrderbookFeed: make(map[string]chan WSNotificationOrderbookUpdate),
-			TradesFeed:    make(map[string]chan WSNotificationTradesUpdate),
-			CandlesFeed:   make(map[string]chan WSNotificationCandlesUpdate),
-		},
+	c, err := newWSClient(cfg, newFeedRegistry(), make(chan error, 16))
+	if err != nil {
+		return nil, err
+	}
+	c.ownsFeeds = true
+	return c, nil
+}
 
-		OrderbookFeed: make(map[string]chan WSNotificationOrderbookSnapshot),
-		TradesFeed:    make(map[string]chan WSNotificationTradesSnapshot),
-		CandlesFeed:   make(map[string]chan WSNotificationCandlesSnapshot),
+// newWSClient connects a client delivering its notifications to feeds and
+// reporting its errors on errs, which may be shared with other clients.
+func newWSClient(cfg WSConfig, feeds *feedRegistry, errs chan error) (*WSClient, error) {
+	handler := responseChannels{
+		feeds:     feeds,
+		inbox:     newFeedQueue(FeedOptions{Buffer: wsInboxSize, Policy: DropNewestPolicy}, nil),
+		ErrorFeed: errs,
+	}
 
-		ErrorFeed: make(chan error),
+	c := &WSClient{
+		config:        cfg,
+		updates:       &handler,
+		requests:      make(map[string]feedRequest),
+		subscriptions: make(map[string]wsSubscription),
+	}
+	c.supervisor = newSupervisor(cfg, c)
+	if err := c.start(); err != nil {
+		return nil, err
 	}
+	go handler.dispatch(c.closed)
 
-	return &WSClient{
-		conn:    jsonrpc2.NewConn(context.Background(), jsonrpc2ws.NewObjectStream(conn), jsonrpc2.AsyncHandler(&handler)),
-		updates: &handler,
-	}, nil
+	return c, nil
 }
 
 // Close closes the Websocket connected to the spiral api.
+//
+// Every subscribed channel is closed before Close returns.
 func (c *WSClient) Close() {
+	c.terminate(ErrWSClientClosed)
+}
+
+// terminate closes the client for good, recording cause as its Err.
+func (c *WSClient) terminate(cause error) {
+	c.stop(cause)
+	c.mu.Lock()
 	c.conn.Close()
+	c.mu.Unlock()
 
-	for _, channel := range c.updates.notifications.TickerFeed {
-		close(channel)
-	}
-	for _, channel := range c.updates.notifications.TradesFeed {
-		close(channel)
-	}
-	for _, channel := range c.updates.notifications.CandlesFeed {
-		close(channel)
-	}
-	for _, channel := range c.updates.notifications.OrderbookFeed {
-		close(channel)
-	}
-	for _, channel := range c.updates.OrderbookFeed {
-		close(channel)
-	}
-	for _, channel := range c.updates.TradesFeed {
-		close(channel)
-	}
-	for _, channel := range c.updates.CandlesFeed {
-		close(channel)
+	if c.ownsFeeds {
+		c.updates.feeds.closeAll()
 	}
+}
+
+// Errors returns the channel reporting notifications that could not be
+// decoded and error responses of the server. Errors are dropped when the
+// channel is not read. The channel is never closed, select on Done to stop
+// reading it.
+func (c *WSClient) Errors() <-chan error {
+	return c.updates.ErrorFeed
+}
+
+// Done returns a channel closed once the client is terminated, either by Close
+// or because the connection could not be restored.
+func (c *WSClient) Done() <-chan struct{} {
+	return c.closed
+}
 
-	close(c.updates.ErrorFeed)
+// Err returns the cause of the termination once Done is closed, nil before.
+func (c *WSClient) Err() error {
+	select {
+	case <-c.closed:
+		return c.err
+	default:
+		return nil
+	}
+}
 
-	c.updates.notifications.TickerFeed = make(map[string]chan WSNotificationTickerResponse)
-	c.updates.notifications.TradesFeed = make(map[string]chan WSNotificationTradesUpdate)
-	c.updates.notifications.OrderbookFeed = make(map[string]chan WSNotificationOrderbookUpdate)
-	c.updates.notifications.CandlesFeed = make(map[string]chan WSNotificationCandlesUpdate)
-	c.updates.CandlesFeed = make(map[string]chan WSNotificationCandlesSnapshot)
-	c.updates.TradesFeed = make(map[string]chan WSNotificationTradesSnapshot)
-	c.updates.OrderbookFeed = make(map[string]chan WSNotificationOrderbookSnapshot)
-	c.updates.ErrorFeed = make(chan error)
+// FeedStats returns the buffering state of every subscribed feed.
+func (c *WSClient) FeedStats() []FeedStats {
+	return c.updates.feeds.stats()
 }
 
 // WSGetCurrencyRequest is get currency request type on websocket
@@ -194,13 +276,24 @@ func (c *WSClient) GetCurrencyInfo(symbol string) (*WSGetCurrencyResponse, error
 	var request = WSGetCurrencyRequest{Currency: symbol}
 	var response WSGetCurrencyResponse
 
-	err := c.conn.Call(context.Background(), "getCurrency", request, &response)
+	err := c.call("getCurrency", request, &response)
 	if err != nil {
 		return nil, errors.Annotate(err, "Spiral GetCurrency")
 	}
 	return &response, nil
 }
 
+// GetCurrencies obtains the info about every currency.
+func (c *WSClient) GetCurrencies() ([]WSGetCurrencyResponse, error) {
+	var response []WSGetCurrencyResponse
+
+	err := c.call("getCurrencies", struct{}{}, &response)
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral GetCurrencies")
+	}
+	return response, nil
+}
+
 // WSGetSymbolRequest is get symbols request type on websocket
 type WSGetSymbolRequest struct {
 	Symbol string `json:"symbol,required"`
@@ -223,37 +316,140 @@ func (c *WSClient) GetSymbol(symbol string) (*WSGetSymbolResponse, error) {
 	var request = WSGetSymbolRequest{Symbol: symbol}
 	var response WSGetSymbolResponse
 
-	err := c.conn.Call(context.Background(), "getSymbol", request, &response)
+	err := c.call("getSymbol", request, &response)
 	if err != nil {
 		return nil, errors.Annotate(err, "Spiral GetSymbol")
 	}
 	return &response, nil
 }
 
-// WSGetTradesRequest is get trades request type on websocket
+// GetSymbols obtains the data of every market.
+func (c *WSClient) GetSymbols() ([]WSGetSymbolResponse, error) {
+	var response []WSGetSymbolResponse
+
+	err := c.call("getSymbols", struct{}{}, &response)
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral GetSymbols")
+	}
+	return response, nil
+}
+
+type sortOrder string
+
+const (
+	SortAscending  sortOrder = "ASC"
+	SortDescending sortOrder = "DESC"
+)
+
+type tradesFilter string
+
+const (
+	FilterByTimestamp tradesFilter = "timestamp" // From and Till bound the trades
+	FilterByID        tradesFilter = "id"        // FromID and TillID bound the trades
+)
+
+// wsMaxTradesLimit is the largest number of trades returned by a getTrades call.
+const wsMaxTradesLimit = 1000
+
+// WSGetTradesRequest is get trades request type on websocket. Zero fields are
+// left to the server defaults.
 type WSGetTradesRequest struct {
-	Symbol string     `json:"symbol,required"`
-	Limit  int        `json:"limit,required"`
-	Sort   string     `json:"sort,required"`
-	By     string     `json:"by,required"`
-	From   *time.Time `json:"from,omitempty"`
-	Till   *time.Time `json:"till,omitempty"`
-	Offset *string    `json:"offset,omitempty"`
+	Symbol string
+	Limit  int          // at most 1000
+	Offset int          // number of trades to skip
+	Sort   sortOrder    // SortAscending or SortDescending
+	By     tradesFilter // FilterByTimestamp or FilterByID
+	From   *time.Time
+	Till   *time.Time
+	FromID int64
+	TillID int64
+}
+
+// validate checks the filters of the request.
+func (r WSGetTradesRequest) validate() error {
+	switch {
+	case r.Symbol == "":
+		return errors.New("symbol is required")
+	case r.Limit < 0 || r.Limit > wsMaxTradesLimit:
+		return errors.Errorf("limit %d out of range [0, %d]", r.Limit, wsMaxTradesLimit)
+	case r.Offset < 0:
+		return errors.Errorf("negative offset %d", r.Offset)
+	case r.Sort != "" && r.Sort != SortAscending && r.Sort != SortDescending:
+		return errors.Errorf("unknown sort %q", r.Sort)
+	case r.By != "" && r.By != FilterByTimestamp && r.By != FilterByID:
+		return errors.Errorf("unknown filter %q", r.By)
+	}
+
+	if r.By == FilterByID {
+		if r.From != nil || r.Till != nil {
+			return errors.New("from and till need the timestamp filter")
+		}
+		if r.FromID < 0 || r.TillID < 0 {
+			return errors.New("negative trade id")
+		}
+		if r.FromID > 0 && r.TillID > 0 && r.FromID > r.TillID {
+			return errors.Errorf("from id %d after till id %d", r.FromID, r.TillID)
+		}
+		return nil
+	}
+	if r.FromID != 0 || r.TillID != 0 {
+		return errors.New("from id and till id need the id filter")
+	}
+	if r.From != nil && r.Till != nil && r.From.After(*r.Till) {
+		return errors.Errorf("from %v after till %v", *r.From, *r.Till)
+	}
+	return nil
+}
+
+// MarshalJSON sends the bounds as timestamps or trade ids depending on By.
+func (r WSGetTradesRequest) MarshalJSON() ([]byte, error) {
+	params := map[string]interface{}{"symbol": r.Symbol}
+	if r.Limit > 0 {
+		params["limit"] = r.Limit
+	}
+	if r.Offset > 0 {
+		params["offset"] = r.Offset
+	}
+	if r.Sort != "" {
+		params["sort"] = r.Sort
+	}
+	if r.By != "" {
+		params["by"] = r.By
+	}
+	if r.By == FilterByID {
+		if r.FromID > 0 {
+			params["from"] = r.FromID
+		}
+		if r.TillID > 0 {
+			params["till"] = r.TillID
+		}
+	} else {
+		if r.From != nil {
+			params["from"] = r.From.UTC().Format(time.RFC3339Nano)
+		}
+		if r.Till != nil {
+			params["till"] = r.Till.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return json.Marshal(params)
 }
 
-// WSGetTradesResponse  is get symbols response type on websocket
+// WSGetTradesResponse  is get trades response type on websocket
 type WSGetTradesResponse struct {
-	Data []WSTrades `json:"data,required"`
+	Data   []WSTrades `json:"data,required"`
+	Symbol string     `json:"symbol"`
 }
 
 // GetTrades obtains the data of a series of trades, based on the specified filters.
-func (c *WSClient) GetTrades(symbol string) (*WSGetTradesResponse, error) {
-	var request = WSGetTradesRequest{Symbol: symbol}
-	var response WSGetTradesResponse
+func (c *WSClient) GetTrades(ctx context.Context, request WSGetTradesRequest) (*WSGetTradesResponse, error) {
+	if err := request.validate(); err != nil {
+		return nil, errors.Annotate(err, "Spiral GetTrades")
+	}
 
-	err := c.conn.Call(context.Background(), "getSymbol", request, &response)
+	var response WSGetTradesResponse
+	err := c.callContext(ctx, "getTrades", request, &response)
 	if err != nil {
-		return nil, errors.Annotate(err, "Spiral GetSymbol")
+		return nil, errors.Annotate(err, "Spiral GetTrades")
 	}
 	return &response, nil
 }
@@ -268,45 +464,40 @@ type WSSubscriptionRequest struct {
 
 // WSNotificationTickerResponse is notification response type on websocket
 type WSNotificationTickerResponse struct {
-	Ask         string `json:"ask,required"`         // Best ask price
-	Bid         string `json:"bid,required"`         // Best bid price
-	Last        string `json:"last,required"`        // Last trade price
-	Open        string `json:"open,required"`        // Last trade price 24 hours ago
-	Low         string `json:"low,required"`         // Lowest trade price within 24 hours
-	High        string `json:"high,required"`        // Highest trade price within 24 hours
-	Volume      string `json:"volume,required"`      // Total trading amount within 24 hours in base currency
-	VolumeQuote string `json:"volumeQuote,required"` // Total trading amount within 24 hours in quote currency
-	Timestamp   string `json:"timestamp,required"`   // Last update or refresh ticker timestamp
-	Symbol      string `json:"symbol,required"`
+	Ask         Decimal   `json:"ask,required"`         // Best ask price
+	Bid         Decimal   `json:"bid,required"`         // Best bid price
+	Last        Decimal   `json:"last,required"`        // Last trade price
+	Open        Decimal   `json:"open,required"`        // Last trade price 24 hours ago
+	Low         Decimal   `json:"low,required"`         // Lowest trade price within 24 hours
+	High        Decimal   `json:"high,required"`        // Highest trade price within 24 hours
+	Volume      Decimal   `json:"volume,required"`      // Total trading amount within 24 hours in base currency
+	VolumeQuote Decimal   `json:"volumeQuote,required"` // Total trading amount within 24 hours in quote currency
+	Timestamp   Timestamp `json:"timestamp,required"`   // Last update or refresh ticker timestamp
+	Symbol      string    `json:"symbol,required"`
 }
 
 // SubscribeTicker subscribes to the specified market ticker notifications.
-func (c *WSClient) SubscribeTicker(symbol string) (<-chan WSNotificationTickerResponse, error) {
-	err := c.subscriptionOp("subscribeTicker", symbol)
+//
+// Close the returned subscription to stop receiving them.
+func (c *WSClient) SubscribeTicker(symbol string, opts ...FeedOptions) (*TickerSubscription, error) {
+	s, err := c.subscribe(tickerRequest(symbol), feedOptions(opts))
 	if err != nil {
 		return nil, errors.Annotate(err, "Spiral SubscribeTicker")
 	}
-
-	if c.updates.notifications.TickerFeed[symbol] == nil {
-		c.updates.notifications.TickerFeed[symbol] = make(chan WSNotificationTickerResponse)
-	}
-
-	return c.updates.notifications.TickerFeed[symbol], nil
+	return newTickerSubscription(s), nil
 }
 
-// UnsubscribeTicker subscribes to the specified market ticker notifications.
-//
-// This closes also the connected channel of updates.
-func (c *WSClient) UnsubscribeTicker(symbol string) error {
-	err := c.subscriptionOp("unsubscribeTicker", symbol)
-	if err != nil {
-		return errors.Annotate(err, "Spiral UnsubscribeTicker")
+func tickerRequest(symbol string) feedRequest {
+	return feedRequest{
+		key:    subscriptionKey("ticker", symbol),
+		create: tickerFeed,
+		subscribe: func(c *WSClient) error {
+			return c.subscriptionOp("subscribeTicker", symbol)
+		},
+		unsubscribe: func(c *WSClient) error {
+			return errors.Annotate(c.subscriptionOp("unsubscribeTicker", symbol), "Spiral UnsubscribeTicker")
+		},
 	}
-
-	close(c.updates.notifications.TickerFeed[symbol])
-	delete(c.updates.notifications.TickerFeed, symbol)
-
-	return nil
 }
 
 // WSNotificationTradesSnapshot is notification response type to trades on websocket
@@ -323,51 +514,41 @@ type WSNotificationTradesUpdate struct {
 
 // WSTrades is item for Trades
 type WSTrades struct {
-	ID        int    `json:"id,required"`
-	Price     string `json:"price,required"`
-	Quantity  string `json:"quantity"`
-	Side      string `json:"side,required"`
-	Timestamp string `json:"timestamp,required"`
+	ID        int       `json:"id,required"`
+	Price     Decimal   `json:"price,required"`
+	Quantity  Decimal   `json:"quantity"`
+	Side      string    `json:"side,required"`
+	Timestamp Timestamp `json:"timestamp,required"`
 }
 
 // SubscribeTrades subscribes to the specified market trades notifications.
-func (c *WSClient) SubscribeTrades(symbol string) (<-chan WSNotificationTradesUpdate, <-chan WSNotificationTradesSnapshot, error) {
-	err := c.subscriptionOp("subscribeTrades", symbol)
+//
+// Close the returned subscription to stop receiving them.
+func (c *WSClient) SubscribeTrades(symbol string, opts ...FeedOptions) (*TradesSubscription, error) {
+	s, err := c.subscribe(tradesRequest(symbol), feedOptions(opts))
 	if err != nil {
-		return nil, nil, errors.Annotate(err, "Spiral SubscribeTrades")
-	}
-
-	if c.updates.notifications.TradesFeed[symbol] == nil {
-		c.updates.notifications.TradesFeed[symbol] = make(chan WSNotificationTradesUpdate)
+		return nil, errors.Annotate(err, "Spiral SubscribeTrades")
 	}
-	if c.updates.TradesFeed[symbol] == nil {
-		c.updates.TradesFeed[symbol] = make(chan WSNotificationTradesSnapshot)
-	}
-
-	return c.updates.notifications.TradesFeed[symbol], c.updates.TradesFeed[symbol], nil
+	return newTradesSubscription(s), nil
 }
 
-// UnsubscribeTrades unsubscribes from the specified market trades notifications and snapshot.
-//
-// This closes also the connected channel of updates.
-func (c *WSClient) UnsubscribeTrades(symbol string) error {
-	err := c.subscriptionOp("unsubscribeTrades", symbol)
-	if err != nil {
-		return errors.Annotate(err, "Spiral UnsubscribeTrades")
+func tradesRequest(symbol string) feedRequest {
+	return feedRequest{
+		key:    subscriptionKey("trades", symbol),
+		create: tradesFeed,
+		subscribe: func(c *WSClient) error {
+			return c.subscriptionOp("subscribeTrades", symbol)
+		},
+		unsubscribe: func(c *WSClient) error {
+			return errors.Annotate(c.subscriptionOp("unsubscribeTrades", symbol), "Spiral UnsubscribeTrades")
+		},
 	}
-
-	close(c.updates.notifications.TradesFeed[symbol])
-	delete(c.updates.notifications.TradesFeed, symbol)
-	close(c.updates.TradesFeed[symbol])
-	delete(c.updates.TradesFeed, symbol)
-
-	return nil
 }
 
 // WSSubtypeTrade is element of market trade type
 type WSSubtypeTrade struct {
-	Price string `json:"price,required"`
-	Size  string `json:"size,required"`
+	Price Decimal `json:"price,required"`
+	Size  Decimal `json:"size,required"`
 }
 
 // WSNotificationOrderbookSnapshot is notification response type to orderbook snapshot on websocket
@@ -387,121 +568,156 @@ type WSNotificationOrderbookUpdate struct {
 }
 
 // SubscribeOrderbook subscribes to the specified market order book notifications.
-func (c *WSClient) SubscribeOrderbook(symbol string) (<-chan WSNotificationOrderbookUpdate, <-chan WSNotificationOrderbookSnapshot, error) {
-	err := c.subscriptionOp("subscribeOrderbook", symbol)
+//
+// Close the returned subscription to stop receiving them.
+func (c *WSClient) SubscribeOrderbook(symbol string, opts ...FeedOptions) (*OrderbookSubscription, error) {
+	s, err := c.subscribe(orderbookRequest(symbol), feedOptions(opts))
 	if err != nil {
-		return nil, nil, errors.Annotate(err, "Spiral SubscribeOrderbook")
-	}
-
-	if c.updates.notifications.OrderbookFeed[symbol] == nil {
-		c.updates.notifications.OrderbookFeed[symbol] = make(chan WSNotificationOrderbookUpdate)
-	}
-	if c.updates.OrderbookFeed[symbol] == nil {
-		c.updates.OrderbookFeed[symbol] = make(chan WSNotificationOrderbookSnapshot)
+		return nil, errors.Annotate(err, "Spiral SubscribeOrderbook")
 	}
-
-	return c.updates.notifications.OrderbookFeed[symbol], c.updates.OrderbookFeed[symbol], nil
+	return newOrderbookSubscription(s), nil
 }
 
-// UnsubscribeOrderbook unsubscribes from the specified market order book notifications and snapshot.
-//
-// This closes also the connected channel of updates.
-func (c *WSClient) UnsubscribeOrderbook(symbol string) error {
-	err := c.subscriptionOp("unsubscribeOrderbook", symbol)
-	if err != nil {
-		return errors.Annotate(err, "Spiral UnsubscribeOrderbook")
+func orderbookRequest(symbol string) feedRequest {
+	return feedRequest{
+		key:    subscriptionKey("orderbook", symbol),
+		create: orderbookFeed,
+		subscribe: func(c *WSClient) error {
+			return c.subscriptionOp("subscribeOrderbook", symbol)
+		},
+		unsubscribe: func(c *WSClient) error {
+			return errors.Annotate(c.subscriptionOp("unsubscribeOrderbook", symbol), "Spiral UnsubscribeOrderbook")
+		},
 	}
-
-	close(c.updates.notifications.OrderbookFeed[symbol])
-	delete(c.updates.notifications.OrderbookFeed, symbol)
-	close(c.updates.OrderbookFeed[symbol])
-	delete(c.updates.OrderbookFeed, symbol)
-
-	return nil
 }
 
+// interval is the period of candles on websocket.
+type interval string
+
 const (
+	// Interval1Minute is 1 minute interval for candle data.
+	Interval1Minute interval = "M1"
+	// Interval3Minutes is 3 minutes interval for candle data.
+	Interval3Minutes interval = "M3"
+	// Interval5Minutes is 5 minutes interval for candle data.
+	Interval5Minutes interval = "M5"
+	// Interval15Minutes is 15 minutes interval for candle data.
+	Interval15Minutes interval = "M15"
 	// Interval30Minutes is 30 minutes interval for candle data.
-	Interval30Minutes string = "M30"
+	Interval30Minutes interval = "M30"
 	// Interval1Hour is 1 hour interval for candle data.
-	Interval1Hour string = "H1"
+	Interval1Hour interval = "H1"
+	// Interval4Hours is 4 hours interval for candle data.
+	Interval4Hours interval = "H4"
+	// Interval1Day is 1 day interval for candle data.
+	Interval1Day interval = "D1"
+	// Interval7Days is 7 days interval for candle data.
+	Interval7Days interval = "D7"
+	// Interval1Month is 1 month interval for candle data.
+	Interval1Month interval = "1M"
 )
 
+// Period returns the kline period matching the interval, empty if there is none.
+func (i interval) Period() Period {
+	switch i {
+	case Interval1Minute:
+		return Period1Minute
+	case Interval3Minutes:
+		return Period3Minutes
+	case Interval5Minutes:
+		return Period5Minutes
+	case Interval15Minutes:
+		return Period15Minutes
+	case Interval30Minutes:
+		return Period30Minutes
+	case Interval1Hour:
+		return Period1Hour
+	case Interval4Hours:
+		return Period4Hours
+	case Interval1Day:
+		return Period1Day
+	case Interval7Days:
+		return Period1Week
+	case Interval1Month:
+		return Period1Month
+	default:
+		return ""
+	}
+}
+
+// interval returns the candle interval matching the kline period p, empty if there is none.
+func (p Period) interval() interval {
+	for _, i := range []interval{
+		Interval1Minute, Interval3Minutes, Interval5Minutes, Interval15Minutes, Interval30Minutes,
+		Interval1Hour, Interval4Hours, Interval1Day, Interval7Days, Interval1Month,
+	} {
+		if i.Period() == p {
+			return i
+		}
+	}
+	return ""
+}
+
 // WSCandlesSubscriptionRequest is a request to subscribe for candle data.
 type WSCandlesSubscriptionRequest struct {
-	Symbol string `json:"symbol,required"`
-	Period string `json:"period,required"`
+	Symbol string   `json:"symbol,required"`
+	Period interval `json:"period,required"`
 }
 
 // WSNotificationCandlesSnapshot is subscribe response type to candles on websocket
 type WSNotificationCandlesSnapshot struct {
 	Data   []WSCandles `json:"data,required"`
 	Symbol string      `json:"symbol,required"`
-	Period string      `json:"period,required"`
+	Period interval    `json:"period,required"`
 }
 
 // WSNotificationCandlesUpdate is subscribe response type to candles on websocket
 type WSNotificationCandlesUpdate struct {
 	Data   WSCandles `json:"data,required"`
 	Symbol string    `json:"symbol,required"`
-	Period string    `json:"period,required"`
+	Period interval  `json:"period,required"`
 }
 
 // WSCandles is item for WSCandles
 type WSCandles struct {
-	Timestamp   time.Time `json:"timestamp,required"`
-	Open        string    `json:"open,required"`
-	Close       string    `json:"close,required"`
-	Min         string    `json:"min,required"`
-	Max         string    `json:"max,required"`
-	Volume      string    `json:"volume,required"`      // Total trading amount within 24 hours in base currency
-	VolumeQuote string    `json:"volumeQuote,required"` // Total trading amount within 24 hours in quote currency
+	Timestamp   Timestamp `json:"timestamp,required"`
+	Open        Decimal   `json:"open,required"`
+	Close       Decimal   `json:"close,required"`
+	Min         Decimal   `json:"min,required"`
+	Max         Decimal   `json:"max,required"`
+	Volume      Decimal   `json:"volume,required"`      // Total trading amount within 24 hours in base currency
+	VolumeQuote Decimal   `json:"volumeQuote,required"` // Total trading amount within 24 hours in quote currency
 }
 
 // SubscribeCandles subscribes to the specified market candle notifications for the specified timeframe.
-func (c *WSClient) SubscribeCandles(symbol string, timeframe string) (<-chan WSNotificationCandlesUpdate, <-chan WSNotificationCandlesSnapshot, error) {
-	err := c.candlesSubscriptionOp("subscribeCandles", symbol, timeframe)
+//
+// Close the returned subscription to stop receiving them.
+func (c *WSClient) SubscribeCandles(symbol string, timeframe interval, opts ...FeedOptions) (*CandlesSubscription, error) {
+	s, err := c.subscribe(candlesRequest(symbol, timeframe), feedOptions(opts))
 	if err != nil {
-		return nil, nil, errors.Annotate(err, "Spiral SubscribeCandles")
-	}
-
-	if c.updates.notifications.CandlesFeed[symbol] == nil {
-		c.updates.notifications.CandlesFeed[symbol] = make(chan WSNotificationCandlesUpdate)
+		return nil, errors.Annotate(err, "Spiral SubscribeCandles")
 	}
-
-	if c.updates.CandlesFeed[symbol] == nil {
-		c.updates.CandlesFeed[symbol] = make(chan WSNotificationCandlesSnapshot)
-	}
-
-	return c.updates.notifications.CandlesFeed[symbol], c.updates.CandlesFeed[symbol], nil
+	return newCandlesSubscription(s), nil
 }
 
-// UnsubscribeCandles unsubscribes from the specified market candle notifications for the specified timeframe.
-//
-// This closes also the connected channel of updates.
-func (c *WSClient) UnsubscribeCandles(symbol string, timeframe string) error {
-	err := c.candlesSubscriptionOp("unsubscribeCandles", symbol, timeframe)
-	if err != nil {
-		return errors.Annotate(err, "Spiral UnsubscribeCandles")
+func candlesRequest(symbol string, timeframe interval) feedRequest {
+	return feedRequest{
+		key:    subscriptionKey("candles", symbol, string(timeframe)),
+		create: candlesFeed,
+		subscribe: func(c *WSClient) error {
+			return c.candlesSubscriptionOp("subscribeCandles", symbol, timeframe)
+		},
+		unsubscribe: func(c *WSClient) error {
+			return errors.Annotate(c.candlesSubscriptionOp("unsubscribeCandles", symbol, timeframe), "Spiral UnsubscribeCandles")
+		},
 	}
-
-	close(c.updates.notifications.CandlesFeed[symbol])
-	delete(c.updates.notifications.CandlesFeed, symbol)
-	close(c.updates.CandlesFeed[symbol])
-	delete(c.updates.CandlesFeed, symbol)
-
-	return nil
 }
 
 func (c *WSClient) subscriptionOp(op string, symbol string) error {
-	if c.conn == nil {
-		return errors.New("Connection is unitialized")
-	}
-
 	var request = WSSubscriptionRequest{Symbol: symbol}
 	var success wsSubscriptionResponse
 
-	err := c.conn.Call(context.Background(), op, request, &success)
+	err := c.call(op, request, &success)
 	if err != nil {
 		return err
 	}
@@ -510,17 +726,25 @@ func (c *WSClient) subscriptionOp(op string, symbol string) error {
 		return errors.New("Subscribe not successful")
 	}
 
+	c.track(subscriptionKey(op, symbol), op, request)
 	return nil
 }
 
-func (c *WSClient) candlesSubscriptionOp(op string, symbol string, period string) error {
+func (c *WSClient) candlesSubscriptionOp(op string, symbol string, period interval) error {
 	var request = WSCandlesSubscriptionRequest{Symbol: symbol, Period: period}
 	var response wsSubscriptionResponse
 
-	err := c.conn.Call(context.Background(), op, request, &response)
+	err := c.call(op, request, &response)
 	if err != nil {
 		return err
 	}
 
+	c.track(subscriptionKey(op, symbol, string(period)), op, request)
 	return nil
 }
+
+// subscriptionKey identifies a feed whatever the subscribe or unsubscribe op used on it.
+func subscriptionKey(op string, args ...string) string {
+	feed := strings.TrimPrefix(strings.TrimPrefix(op, "un"), "subscribe")
+	return strings.Join(append([]string{strings.ToLower(feed)}, args...), ":")
+}
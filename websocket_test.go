@@ -0,0 +1,38 @@
+package spiral
+
+import "testing"
+
+func TestCandleIntervals(t *testing.T) {
+	for _, c := range []struct {
+		i interval
+		p Period
+	}{
+		{Interval1Minute, Period1Minute},
+		{Interval3Minutes, Period3Minutes},
+		{Interval5Minutes, Period5Minutes},
+		{Interval15Minutes, Period15Minutes},
+		{Interval30Minutes, Period30Minutes},
+		{Interval1Hour, Period1Hour},
+		{Interval4Hours, Period4Hours},
+		{Interval1Day, Period1Day},
+		{Interval7Days, Period1Week},
+		{Interval1Month, Period1Month},
+	} {
+		if p := c.i.Period(); p != c.p {
+			t.Errorf("interval %s has period %q, want %q", c.i, string(p), string(c.p))
+		}
+		if i := c.p.interval(); i != c.i {
+			t.Errorf("period %q has interval %s, want %s", string(c.p), i, c.i)
+		}
+	}
+
+	// periods the WebSocket API does not stream
+	for _, p := range []Period{Period2Hours, Period6Hours, Period12Hours, Period("")} {
+		if i := p.interval(); i != "" {
+			t.Errorf("period %q has interval %s", string(p), i)
+		}
+	}
+	if p := interval("H2").Period(); p != "" {
+		t.Errorf("interval H2 has period %q", string(p))
+	}
+}
@@ -0,0 +1,307 @@
+package spiral
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/juju/errors"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+type reportType string
+
+const (
+	StatusReport    reportType = "status"    // sent for each active order right after subscribing
+	NewReport       reportType = "new"       // order accepted
+	TradeReport     reportType = "trade"     // order partially or fully filled
+	CanceledReport  reportType = "canceled"  // order cancelled
+	ExpiredReport   reportType = "expired"   // order expired
+	SuspendedReport reportType = "suspended" // order suspended
+	ReplacedReport  reportType = "replaced"  // order replaced by another one
+	RejectedReport  reportType = "rejected"  // order rejected
+)
+
+// wsOrderStatus maps websocket order statuses to orderStatus values.
+var wsOrderStatus = map[string]orderStatus{
+	"new":             Accepted,
+	"suspended":       Waiting,
+	"partiallyFilled": PartialFilled,
+	"filled":          Filled,
+	"canceled":        Cancelled,
+	"expired":         Cancelled,
+	"rejected":        Rejected,
+}
+
+// wsSide maps websocket order sides to side values.
+var wsSide = map[string]side{
+	"buy":  BidSide,
+	"sell": AskSide,
+}
+
+// WSLoginRequest is login request type on websocket.
+type WSLoginRequest struct {
+	Algo      string `json:"algo,required"`
+	PKey      string `json:"pKey,required"`
+	Nonce     string `json:"nonce,required"`
+	Signature string `json:"signature,required"`
+}
+
+// wsCredentials are the API key and secret a WSClient logs in with.
+type wsCredentials struct {
+	apiKey    string
+	apiSecret string
+}
+
+// loginRequest signs a login request with a fresh nonce, a nonce being
+// accepted once only.
+func (k wsCredentials) loginRequest() (WSLoginRequest, error) {
+	nonce, err := randomID()
+	if err != nil {
+		return WSLoginRequest{}, err
+	}
+	return WSLoginRequest{
+		Algo:      "HS256",
+		PKey:      k.apiKey,
+		Nonce:     nonce,
+		Signature: computeHmac256(nonce, k.apiSecret),
+	}, nil
+}
+
+// login authenticates the session of conn with credentials.
+func login(ctx context.Context, conn *jsonrpc2.Conn, credentials wsCredentials) error {
+	request, err := credentials.loginRequest()
+	if err != nil {
+		return err
+	}
+	var success wsSubscriptionResponse
+	if err := conn.Call(ctx, "login", request, &success); err != nil {
+		return err
+	}
+	if !success {
+		return errors.New("login not successful")
+	}
+	return nil
+}
+
+// Login authenticates the websocket session with the API key and secret used
+// by the REST client. The session is logged in again after a reconnection,
+// signed with a new nonce.
+func (c *WSClient) Login(apiKey, apiSecret string) error {
+	credentials := wsCredentials{apiKey: apiKey, apiSecret: apiSecret}
+	request, err := credentials.loginRequest()
+	if err != nil {
+		return errors.Annotate(err, "Spiral Login")
+	}
+
+	var success wsSubscriptionResponse
+	if err := c.call("login", request, &success); err != nil {
+		return errors.Annotate(err, "Spiral Login")
+	}
+	if !success {
+		return errors.New("Spiral Login: login not successful")
+	}
+
+	c.mu.Lock()
+	c.credentials = &credentials
+	c.mu.Unlock()
+	return nil
+}
+
+// WSOrderReport is a report about one of your orders on websocket.
+//
+// Side and Status are translated to the values used by the REST API.
+type WSOrderReport struct {
+	ID                           int64       `json:"id,string"`
+	ClientOrderID                string      `json:"clientOrderId"`
+	Symbol                       string      `json:"symbol"`
+	Side                         side        `json:"-"`
+	Status                       orderStatus `json:"-"`
+	Type                         orderType   `json:"type"`
+	TimeInForce                  string      `json:"timeInForce"`
+	Quantity                     float64     `json:"quantity,string"`
+	Price                        float64     `json:"price,string"`
+	CumQuantity                  float64     `json:"cumQuantity,string"` // quantity filled so far
+	CreatedAt                    Timestamp   `json:"createdAt"`
+	UpdatedAt                    Timestamp   `json:"updatedAt"`
+	ReportType                   reportType  `json:"reportType"`
+	OriginalRequestClientOrderID string      `json:"originalRequestClientOrderId"` // set on ReplacedReport
+
+	// set on TradeReport
+	TradeID       int64   `json:"tradeId"`
+	TradeQuantity float64 `json:"tradeQuantity,string"`
+	TradePrice    float64 `json:"tradePrice,string"`
+	TradeFee      float64 `json:"tradeFee,string"`
+}
+
+// UnmarshalJSON for WSOrderReport function
+func (r *WSOrderReport) UnmarshalJSON(data []byte) error {
+	type Alias WSOrderReport
+	aux := &struct {
+		Side   string `json:"side"`
+		Status string `json:"status"`
+		*Alias
+	}{
+		Alias: (*Alias)(r),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	r.Side = wsSide[aux.Side]
+	r.Status = Unknown
+	if status, ok := wsOrderStatus[aux.Status]; ok {
+		r.Status = status
+	}
+	if r.ReportType == RejectedReport {
+		r.Status = Rejected
+	}
+	return nil
+}
+
+// WSBalance is the balance of a currency on websocket.
+type WSBalance struct {
+	Currency  string  `json:"currency"`
+	Available float64 `json:"available,string"`
+	Reserved  float64 `json:"reserved,string"`
+}
+
+// SubscribeReports subscribes to the reports of your orders. The snapshot
+// channel receives the active orders right after subscribing, the updates
+// channel every change of an order afterwards. Login must be called first.
+func (c *WSClient) SubscribeReports(opts ...FeedOptions) (*ReportsSubscription, error) {
+	s, err := c.subscribe(feedRequest{
+		key:    subscriptionKey("reports"),
+		create: reportsFeed,
+		subscribe: func(c *WSClient) error {
+			return c.accountSubscriptionOp("subscribeReports")
+		},
+		unsubscribe: func(c *WSClient) error {
+			return errors.Annotate(c.accountSubscriptionOp("unsubscribeReports"), "Spiral UnsubscribeReports")
+		},
+	}, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral SubscribeReports")
+	}
+
+	return &ReportsSubscription{
+		Subscription: s,
+		Updates:      s.feed.updates.(<-chan WSOrderReport),
+		Snapshots:    s.feed.snapshots.(<-chan []WSOrderReport),
+	}, nil
+}
+
+// SubscribeBalances subscribes to the changes of your balances. Each
+// notification holds the balances of the currencies that changed. Login must
+// be called first.
+func (c *WSClient) SubscribeBalances(opts ...FeedOptions) (*BalancesSubscription, error) {
+	s, err := c.subscribe(feedRequest{
+		key:    subscriptionKey("balance"),
+		create: balancesFeed,
+		subscribe: func(c *WSClient) error {
+			return c.accountSubscriptionOp("subscribeBalance")
+		},
+		unsubscribe: func(c *WSClient) error {
+			return errors.Annotate(c.accountSubscriptionOp("unsubscribeBalance"), "Spiral UnsubscribeBalances")
+		},
+	}, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral SubscribeBalances")
+	}
+
+	return &BalancesSubscription{Subscription: s, Updates: s.feed.updates.(<-chan []WSBalance)}, nil
+}
+
+// GetTradingBalance obtains the balances of your trading account.
+func (c *WSClient) GetTradingBalance() ([]WSBalance, error) {
+	var response []WSBalance
+
+	err := c.call("getTradingBalance", struct{}{}, &response)
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral GetTradingBalance")
+	}
+	return response, nil
+}
+
+func (c *WSClient) accountSubscriptionOp(op string) error {
+	var request = struct{}{}
+	var success wsSubscriptionResponse
+
+	err := c.call(op, request, &success)
+	if err != nil {
+		return err
+	}
+
+	if !success {
+		return errors.New("Subscribe not successful")
+	}
+
+	c.track(subscriptionKey(op), op, request)
+	return nil
+}
+
+func reportsFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan WSOrderReport)
+	snapshots := make(chan []WSOrderReport)
+	f := newFeed(key, newFeedQueue(opts, nil), func(msg interface{}, done <-chan struct{}) bool {
+		switch m := msg.(type) {
+		case WSOrderReport:
+			select {
+			case updates <- m:
+				return true
+			case <-done:
+				return false
+			}
+		case []WSOrderReport:
+			select {
+			case snapshots <- m:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		return true
+	}, func() {
+		close(updates)
+		close(snapshots)
+	})
+	f.updates = (<-chan WSOrderReport)(updates)
+	f.snapshots = (<-chan []WSOrderReport)(snapshots)
+	return f
+}
+
+func balancesFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan []WSBalance)
+	f := newFeed(key, newFeedQueue(opts, mergeBalances), func(msg interface{}, done <-chan struct{}) bool {
+		select {
+		case updates <- msg.([]WSBalance):
+			return true
+		case <-done:
+			return false
+		}
+	}, func() { close(updates) })
+	f.updates = (<-chan []WSBalance)(updates)
+	return f
+}
+
+// mergeBalances conflates balance notifications, keeping the latest balance of each currency.
+func mergeBalances(prev, next interface{}) (interface{}, bool) {
+	p, ok := prev.([]WSBalance)
+	if !ok {
+		return nil, false
+	}
+	merged := append([]WSBalance(nil), p...)
+	for _, b := range next.([]WSBalance) {
+		found := false
+		for i := range merged {
+			if merged[i].Currency == b.Currency {
+				merged[i] = b
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, b)
+		}
+	}
+	return merged, true
+}
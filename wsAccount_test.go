@@ -0,0 +1,56 @@
+package spiral
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLoginRequestSignsFreshNonce(t *testing.T) {
+	credentials := wsCredentials{apiKey: "key", apiSecret: "secret"}
+	first, err := credentials.loginRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := credentials.loginRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []WSLoginRequest{first, second} {
+		if r.Algo != "HS256" || r.PKey != "key" || r.Signature != computeHmac256(r.Nonce, "secret") {
+			t.Errorf("login request %+v not signed with the credentials", r)
+		}
+	}
+	if first.Nonce == second.Nonce {
+		t.Errorf("nonce %q signed twice", first.Nonce)
+	}
+}
+
+func TestLoginSignedAgainOnReconnect(t *testing.T) {
+	server := newRPCServer(t)
+	client, err := NewWSClientWithConfig(WSConfig{URL: server.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Login("key", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	var first WSLoginRequest
+	json.Unmarshal(server.lastParams("login"), &first)
+
+	server.disconnect()
+	eventually(t, "login after the reconnection", func() bool { return server.count("login") == 2 })
+	var second WSLoginRequest
+	json.Unmarshal(server.lastParams("login"), &second)
+
+	for _, r := range []WSLoginRequest{first, second} {
+		if r.PKey != "key" || r.Signature != computeHmac256(r.Nonce, "secret") {
+			t.Errorf("login request %+v not signed with the credentials", r)
+		}
+	}
+	if first.Nonce == second.Nonce || first.Signature == second.Signature {
+		t.Errorf("login replayed with nonce %q", second.Nonce)
+	}
+}
@@ -0,0 +1,511 @@
+package spiral
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/juju/errors"
+	"github.com/sourcegraph/jsonrpc2"
+	jsonrpc2ws "github.com/sourcegraph/jsonrpc2/websocket"
+)
+
+const (
+	wsPingInterval      = 30 * time.Second // default interval between two pings
+	wsPongWait          = 60 * time.Second // default time allowed to read the next pong or message
+	wsWriteWait         = 10 * time.Second // default time allowed to write a message
+	wsCallWait          = 10 * time.Second // default time allowed for the server to answer
+	wsMinReconnectDelay = time.Second
+	wsMaxReconnectDelay = time.Minute
+)
+
+// WSConfig configures the connection of a WSClient or StreamClient. Zero
+// fields take their default value.
+type WSConfig struct {
+	URL string // defaults to the endpoint of the client
+
+	PingInterval time.Duration // interval between two pings, 30s by default
+	PongTimeout  time.Duration // time allowed to read the next pong or message, 60s by default
+	WriteTimeout time.Duration // time allowed to write a message, 10s by default
+	CallTimeout  time.Duration // time allowed for the server to answer a call or command, 10s by default
+
+	// MaxReconnectAttempts and ReconnectTimeout bound the reconnection after
+	// the connection dropped, by failed attempts and by time. Once exceeded
+	// the client is terminated, Err returning the last dial error. Both are
+	// unlimited when 0.
+	MaxReconnectAttempts int
+	ReconnectTimeout     time.Duration
+
+	// Dialer sets the proxy, TLS config and handshake timeout, websocket.DefaultDialer by default.
+	Dialer *websocket.Dialer
+	// Header is sent with the handshake request.
+	Header http.Header
+}
+
+// withDefaults returns cfg with its zero fields set to their default value.
+func (cfg WSConfig) withDefaults() (WSConfig, error) {
+	if cfg.URL == "" {
+		cfg.URL = wsAPIURL
+	}
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = wsPingInterval
+	}
+	if cfg.PongTimeout == 0 {
+		cfg.PongTimeout = wsPongWait
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = wsWriteWait
+	}
+	if cfg.CallTimeout == 0 {
+		cfg.CallTimeout = wsCallWait
+	}
+	if cfg.Dialer == nil {
+		cfg.Dialer = websocket.DefaultDialer
+	}
+	if cfg.PingInterval < 0 || cfg.WriteTimeout < 0 || cfg.CallTimeout < 0 || cfg.ReconnectTimeout < 0 {
+		return cfg, errors.New("negative websocket timeout")
+	}
+	if cfg.MaxReconnectAttempts < 0 {
+		return cfg, errors.New("negative reconnection attempts")
+	}
+	if cfg.PongTimeout <= cfg.PingInterval {
+		return cfg, errors.Errorf("pong timeout %v must exceed the ping interval %v", cfg.PongTimeout, cfg.PingInterval)
+	}
+	return cfg, nil
+}
+
+// backoff returns how long to wait after the failed reconnection attempt, at
+// most delay, or the error terminating the client once the attempts or the
+// time since the connection was lost exceed the config. err is the error of
+// the attempt.
+func (cfg WSConfig) backoff(attempt int, delay time.Duration, lost time.Time, err error) (time.Duration, error) {
+	if cfg.MaxReconnectAttempts > 0 && attempt >= cfg.MaxReconnectAttempts {
+		return 0, errors.Annotatef(err, "Spiral websocket gave up reconnecting after %d attempts", attempt)
+	}
+	if cfg.ReconnectTimeout > 0 {
+		left := cfg.ReconnectTimeout - time.Since(lost)
+		if left <= 0 {
+			return 0, errors.Annotatef(err, "Spiral websocket gave up reconnecting after %v", cfg.ReconnectTimeout)
+		}
+		if delay > left {
+			delay = left // a last attempt at the deadline
+		}
+	}
+	return delay, nil
+}
+
+type connectionState int
+
+const (
+	// ConnectedState is emitted once a connection is established.
+	ConnectedState connectionState = iota
+	// DisconnectedState is emitted when the connection dropped, the data may have gaps from there.
+	DisconnectedState
+	// ReconnectingState is emitted before each reconnection attempt.
+	ReconnectingState
+	// ResubscribedState is emitted once the subscriptions are restored after a reconnection.
+	ResubscribedState
+)
+
+func (s connectionState) String() string {
+	switch s {
+	case ConnectedState:
+		return "connected"
+	case DisconnectedState:
+		return "disconnected"
+	case ReconnectingState:
+		return "reconnecting"
+	case ResubscribedState:
+		return "resubscribed"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionEvent notifies a change of the WebSocket connection state.
+type ConnectionEvent struct {
+	State      connectionState
+	Connection int   // index of the connection within a WSPool, 0 otherwise
+	Attempt    int   // reconnection attempt, starting at 1
+	Err        error // cause of the disconnection, failed attempt or failed resubscriptions
+	Time       time.Time
+}
+
+// wsSubscription is an active server side subscription, replayed after a reconnection.
+type wsSubscription struct {
+	method string
+	params interface{}
+}
+
+// connError records the error that broke a connection.
+type connError struct {
+	mu  sync.Mutex
+	err error
+}
+
+// set records err unless an error was recorded already.
+func (e *connError) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// get returns the recorded error, a generic one if none was.
+func (e *connError) get() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		return errors.New("connection lost")
+	}
+	return e.err
+}
+
+// dial opens a new JSON RPC connection dispatching notifications to the
+// client handler. The returned connError records why it dropped.
+func (c *WSClient) dial() (*jsonrpc2.Conn, *connError, error) {
+	ws, _, err := c.config.Dialer.Dial(c.config.URL, c.config.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a missed pong fails the pending read, which closes the JSON RPC connection
+	watchPongs(ws, c.config, &c.latency)
+
+	lost := &connError{}
+	stream := deadlineStream{ObjectStream: jsonrpc2ws.NewObjectStream(ws), ws: ws, config: c.config, lost: lost}
+	conn := jsonrpc2.NewConn(context.Background(), stream, c.updates)
+	go keepAlive(ws, c.config, conn.DisconnectNotify(), lost)
+	return conn, lost, nil
+}
+
+// watchPongs extends the read deadline of ws on each pong and stores the
+// round trip time in nanoseconds measured by the pong in latency.
+func watchPongs(ws *websocket.Conn, config WSConfig, latency *int64) {
+	ws.SetReadDeadline(time.Now().Add(config.PongTimeout))
+	ws.SetPongHandler(func(payload string) error {
+		if sent, err := strconv.ParseInt(payload, 10, 64); err == nil {
+			atomic.StoreInt64(latency, time.Now().UnixNano()-sent)
+		}
+		return ws.SetReadDeadline(time.Now().Add(config.PongTimeout))
+	})
+}
+
+// deadlineStream bounds the time spent writing a message and extends the
+// read deadline after each message read. The read error closing the
+// connection is recorded in lost.
+type deadlineStream struct {
+	jsonrpc2ws.ObjectStream
+	ws     *websocket.Conn
+	config WSConfig
+	lost   *connError
+}
+
+// WriteObject implements jsonrpc2.ObjectStream.
+func (s deadlineStream) WriteObject(obj interface{}) error {
+	s.ws.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+	return s.ObjectStream.WriteObject(obj)
+}
+
+// ReadObject implements jsonrpc2.ObjectStream.
+func (s deadlineStream) ReadObject(v interface{}) error {
+	err := s.ObjectStream.ReadObject(v)
+	if err != nil {
+		s.lost.set(err)
+		return err
+	}
+	s.ws.SetReadDeadline(time.Now().Add(s.config.PongTimeout))
+	return nil
+}
+
+// keepAlive pings the server until the connection is closed. Each ping
+// carries its send time so the pong measures the round trip. A failed ping
+// closes the connection, recording its error in lost.
+func keepAlive(ws *websocket.Conn, config WSConfig, done <-chan struct{}, lost *connError) {
+	ticker := time.NewTicker(config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			payload := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+			if err := ws.WriteControl(websocket.PingMessage, payload, time.Now().Add(config.WriteTimeout)); err != nil {
+				lost.set(errors.Annotate(err, "ping failed"))
+				ws.Close()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Latency returns the round trip time measured by the last ping, zero until
+// the first pong is received.
+func (c *WSClient) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.latency))
+}
+
+// transport is the connection of a WSClient or StreamClient, kept up by a
+// supervisor.
+type transport interface {
+	// connect dials a new connection and makes it the current one. The
+	// returned channel is closed once it drops, after the cause is recorded
+	// in the connError.
+	connect() (<-chan struct{}, *connError, error)
+	// resubscribe restores the subscriptions on the current connection.
+	resubscribe() error
+	// terminate closes the client for good, recording cause as its Err.
+	terminate(cause error)
+}
+
+// supervisor reconnects a transport each time its connection drops, with an
+// exponential backoff, and restores its subscriptions, reporting each step on
+// the connection events. It gives up once the client is terminated or the
+// reconnection policy of the config is exceeded.
+type supervisor struct {
+	config    WSConfig
+	transport transport
+
+	events    chan ConnectionEvent
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error // cause of the termination, set before closed is closed
+}
+
+func newSupervisor(cfg WSConfig, t transport) *supervisor {
+	return &supervisor{
+		config:    cfg,
+		transport: t,
+		events:    make(chan ConnectionEvent, 16),
+		closed:    make(chan struct{}),
+	}
+}
+
+// start connects the transport and supervises its connection.
+func (s *supervisor) start() error {
+	done, lost, err := s.transport.connect()
+	if err != nil {
+		return err
+	}
+	s.emit(ConnectionEvent{State: ConnectedState})
+	go s.supervise(done, lost)
+	return nil
+}
+
+// stop records cause as the termination cause and closes closed, unless the
+// client is terminated already.
+func (s *supervisor) stop(cause error) {
+	s.closeOnce.Do(func() {
+		s.err = cause
+		close(s.closed)
+	})
+}
+
+// supervise reconnects each time the connection drops, until the client is
+// closed or gives up reconnecting.
+func (s *supervisor) supervise(done <-chan struct{}, lost *connError) {
+	for {
+		select {
+		case <-done:
+		case <-s.closed:
+			return
+		}
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+
+		s.emit(ConnectionEvent{State: DisconnectedState, Err: lost.get()})
+		if done, lost = s.reconnect(); done == nil {
+			return
+		}
+	}
+}
+
+// reconnect dials with an exponential backoff and restores the subscriptions.
+// It returns nil if the client was closed meanwhile, or terminates the client
+// and returns nil once the reconnection policy of the config gives up.
+func (s *supervisor) reconnect() (<-chan struct{}, *connError) {
+	since := time.Now()
+	delay := wsMinReconnectDelay
+	for attempt := 1; ; attempt++ {
+		s.emit(ConnectionEvent{State: ReconnectingState, Attempt: attempt})
+
+		done, lost, err := s.transport.connect()
+		if err == nil {
+			select {
+			case <-s.closed:
+				s.transport.terminate(s.err) // closes the new connection
+				return nil, nil
+			default:
+			}
+			s.emit(ConnectionEvent{State: ConnectedState, Attempt: attempt})
+			s.emit(ConnectionEvent{State: ResubscribedState, Attempt: attempt, Err: s.transport.resubscribe()})
+			return done, lost
+		}
+
+		s.emit(ConnectionEvent{State: ReconnectingState, Attempt: attempt, Err: err})
+		wait, cause := s.config.backoff(attempt, delay, since, err)
+		if cause != nil {
+			s.transport.terminate(cause)
+			return nil, nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-s.closed:
+			return nil, nil
+		}
+		if delay *= 2; delay > wsMaxReconnectDelay {
+			delay = wsMaxReconnectDelay
+		}
+	}
+}
+
+// emit sends ev without blocking, dropping it if nobody keeps up with the events.
+func (s *supervisor) emit(ev ConnectionEvent) {
+	ev.Time = time.Now()
+	select {
+	case s.events <- ev:
+	default:
+	}
+}
+
+// connect dials a new JSON RPC connection and makes it the current one.
+func (c *WSClient) connect() (<-chan struct{}, *connError, error) {
+	conn, lost, err := c.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	return conn.DisconnectNotify(), lost, nil
+}
+
+// resubscribe logs in again if needed and replays every active subscription
+// on the current connection. Subscriptions closed or forgotten while being
+// replayed are closed again.
+func (c *WSClient) resubscribe() error {
+	c.mu.Lock()
+	conn := c.conn
+	credentials := c.credentials
+	subscriptions := make(map[string]wsSubscription, len(c.subscriptions))
+	for key, s := range c.subscriptions {
+		subscriptions[key] = s
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.CallTimeout)
+	defer cancel()
+	if credentials != nil {
+		if err := login(ctx, conn, *credentials); err != nil {
+			return errors.Annotate(err, "login failed")
+		}
+	}
+
+	var failed []string
+	for _, s := range subscriptions {
+		var response wsSubscriptionResponse
+		if err := conn.Call(ctx, s.method, s.params, &response); err != nil {
+			failed = append(failed, s.method+": "+err.Error())
+		}
+	}
+
+	c.mu.Lock()
+	for key := range c.subscriptions {
+		delete(subscriptions, key)
+	}
+	c.mu.Unlock()
+	for _, s := range subscriptions {
+		var response wsSubscriptionResponse
+		if err := conn.Call(ctx, "un"+s.method, s.params, &response); err != nil {
+			failed = append(failed, "un"+s.method+": "+err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("resubscribe failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// track records a successful subscription change so it can be replayed.
+func (c *WSClient) track(key string, method string, params interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if strings.HasPrefix(method, "unsubscribe") {
+		delete(c.subscriptions, key)
+		return
+	}
+	c.subscriptions[key] = wsSubscription{method: method, params: params}
+}
+
+// trackedKeys returns the keys of the active subscriptions.
+func (c *WSClient) trackedKeys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.subscriptions))
+	for key := range c.subscriptions {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// forget forgets the subscription key so it is not restored after a
+// reconnection, leaving the server subscription as is.
+func (c *WSClient) forget(key string) {
+	c.mu.Lock()
+	delete(c.subscriptions, key)
+	c.mu.Unlock()
+}
+
+// drop forgets the subscription key, so it is not restored after a
+// reconnection, and unsubscribes from it on the server.
+func (c *WSClient) drop(key string) error {
+	c.mu.Lock()
+	s, ok := c.subscriptions[key]
+	delete(c.subscriptions, key)
+	c.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	var response wsSubscriptionResponse
+	return c.call("un"+s.method, s.params, &response)
+}
+
+// ConnectionEvents returns the channel notifying connection state changes.
+// Events are dropped when the channel is not read.
+func (c *WSClient) ConnectionEvents() <-chan ConnectionEvent {
+	return c.events
+}
+
+// call performs a JSON RPC call on the current connection, giving up after
+// the CallTimeout of the config. Error responses of the server are reported
+// on Errors as well.
+func (c *WSClient) call(method string, params, result interface{}) error {
+	return c.callContext(context.Background(), method, params, result)
+}
+
+// callContext is call, giving up as well when ctx is done.
+func (c *WSClient) callContext(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return errors.New("Connection is unitialized")
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.config.CallTimeout)
+	defer cancel()
+	err := conn.Call(ctx, method, params, result)
+	if rpcErr, ok := err.(*jsonrpc2.Error); ok {
+		c.updates.reportError(errors.Annotatef(rpcErr, "Spiral %s", method))
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package spiral
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWSConfigBackoff(t *testing.T) {
+	dialErr := errors.New("dial failed")
+	now := time.Now()
+
+	cfg := WSConfig{MaxReconnectAttempts: 3}
+	if wait, err := cfg.backoff(2, time.Second, now, dialErr); wait != time.Second || err != nil {
+		t.Errorf("attempt 2 of 3 = %v, %v", wait, err)
+	}
+	if _, err := cfg.backoff(3, time.Second, now, dialErr); err == nil || !strings.Contains(err.Error(), "dial failed") {
+		t.Errorf("attempt 3 of 3 = %v", err)
+	}
+
+	cfg = WSConfig{ReconnectTimeout: time.Minute}
+	if wait, err := cfg.backoff(1, 2*time.Minute, now.Add(-50*time.Second), dialErr); err != nil || wait > 10*time.Second {
+		t.Errorf("backoff near the deadline = %v, %v", wait, err)
+	}
+	if _, err := cfg.backoff(9, time.Second, now.Add(-time.Minute), dialErr); err == nil {
+		t.Error("backoff past the deadline did not give up")
+	}
+
+	if wait, err := (WSConfig{}).backoff(100, time.Minute, now.Add(-time.Hour), dialErr); wait != time.Minute || err != nil {
+		t.Errorf("unlimited backoff = %v, %v", wait, err)
+	}
+	if _, err := (WSConfig{MaxReconnectAttempts: -1}).withDefaults(); err == nil {
+		t.Error("negative MaxReconnectAttempts accepted")
+	}
+}
+
+// waitEvent returns the next event of state, failing after 5 seconds.
+func waitEvent(t *testing.T, events <-chan ConnectionEvent, state connectionState) ConnectionEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.State == state {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no %v event", state)
+		}
+	}
+}
+
+func TestWSClientGivesUp(t *testing.T) {
+	server := newRPCServer(t)
+	client, err := NewWSClientWithConfig(WSConfig{URL: server.url(), MaxReconnectAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ticker, err := client.SubscribeTicker("ETHBTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	server.disconnect()
+	ev := waitEvent(t, client.ConnectionEvents(), DisconnectedState)
+	if ev.Err == nil || ev.Err.Error() == "connection lost" {
+		t.Errorf("disconnection cause = %v, want the read error", ev.Err)
+	}
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not give up")
+	}
+	if err := client.Err(); err == nil || !strings.Contains(err.Error(), "gave up reconnecting after 2 attempts") {
+		t.Errorf("Err = %v", err)
+	}
+	if _, ok := <-ticker.Updates; ok {
+		t.Error("ticker open after the client gave up")
+	}
+}
+
+func TestStreamClientGivesUp(t *testing.T) {
+	server := newStreamServer(t)
+	client, err := NewStreamClient(WSConfig{URL: server.url(), ReconnectTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	book, err := client.StreamBook("BTCUSDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.stop()
+	ev := waitEvent(t, client.ConnectionEvents(), DisconnectedState)
+	if ev.Err == nil || ev.Err.Error() == "connection lost" {
+		t.Errorf("disconnection cause = %v, want the read error", ev.Err)
+	}
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not give up")
+	}
+	if err := client.Err(); err == nil || !strings.Contains(err.Error(), "gave up reconnecting after 100ms") {
+		t.Errorf("Err = %v", err)
+	}
+	if _, ok := <-book.Updates; ok {
+		t.Error("book open after the client gave up")
+	}
+}
+
+// fakeTransport hands out the connections sent on dials, a nil one failing
+// the dial.
+type fakeTransport struct {
+	supervisor   *supervisor
+	dials        chan chan struct{}
+	resubscribes chan struct{}
+	terminated   chan error
+}
+
+func newFakeTransport(cfg WSConfig) *fakeTransport {
+	t := &fakeTransport{
+		dials:        make(chan chan struct{}),
+		resubscribes: make(chan struct{}, 4),
+		terminated:   make(chan error, 4),
+	}
+	t.supervisor = newSupervisor(cfg, t)
+	return t
+}
+
+func (t *fakeTransport) connect() (<-chan struct{}, *connError, error) {
+	done := <-t.dials
+	if done == nil {
+		return nil, nil, errors.New("dial failed")
+	}
+	return done, &connError{}, nil
+}
+
+func (t *fakeTransport) resubscribe() error {
+	t.resubscribes <- struct{}{}
+	return nil
+}
+
+func (t *fakeTransport) terminate(cause error) {
+	t.supervisor.stop(cause)
+	t.terminated <- cause
+}
+
+func TestSupervisor(t *testing.T) {
+	tr := newFakeTransport(WSConfig{MaxReconnectAttempts: 1})
+	s := tr.supervisor
+	first := make(chan struct{})
+	go func() { tr.dials <- first }()
+	if err := s.start(); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, s.events, ConnectedState)
+
+	// a dropped connection is replaced and its subscriptions restored
+	close(first)
+	second := make(chan struct{})
+	tr.dials <- second
+	if ev := waitEvent(t, s.events, ResubscribedState); ev.Attempt != 1 || len(tr.resubscribes) != 1 {
+		t.Errorf("resubscribed event %+v after %d resubscriptions", ev, len(tr.resubscribes))
+	}
+
+	// a connection established once the client is closed is closed as well
+	close(second)
+	waitEvent(t, s.events, ReconnectingState)
+	s.stop(ErrWSClientClosed)
+	tr.dials <- make(chan struct{})
+	select {
+	case cause := <-tr.terminated:
+		if cause != ErrWSClientClosed {
+			t.Errorf("terminated by %v", cause)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection of a closed client kept")
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	tr := newFakeTransport(WSConfig{MaxReconnectAttempts: 1})
+	s := tr.supervisor
+	first := make(chan struct{})
+	go func() { tr.dials <- first }()
+	if err := s.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	close(first)
+	tr.dials <- nil
+	select {
+	case cause := <-tr.terminated:
+		if cause == nil || !strings.Contains(cause.Error(), "dial failed") {
+			t.Errorf("terminated by %v", cause)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor did not give up")
+	}
+	<-s.closed
+	if s.err == nil || len(tr.resubscribes) != 0 {
+		t.Errorf("err = %v after %d resubscriptions", s.err, len(tr.resubscribes))
+	}
+}
@@ -0,0 +1,497 @@
+package spiral
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+)
+
+type overflowPolicy int
+
+const (
+	// BlockPolicy waits for the consumer when the feed buffer is full. As
+	// notifications are dispatched in order, a blocked feed holds back every
+	// other feed of the client until its consumer catches up. The connection
+	// keeps reading meanwhile: once the client inbox is full new notifications
+	// are dropped and counted in the Dropped stats of the feeds they were for.
+	BlockPolicy overflowPolicy = iota
+	// DropOldestPolicy discards the oldest buffered notification to make room for a new one.
+	DropOldestPolicy
+	// DropNewestPolicy discards new notifications while the buffer is full.
+	DropNewestPolicy
+	// ConflatePolicy merges a new notification into the buffered ones so the
+	// consumer only sees the latest state: tickers replace each other and
+	// order book updates are merged level by level, skipping sequences.
+	// Trades, candles and order reports cannot be merged without losing some,
+	// their feeds reject it with ErrConflateUnsupported.
+	ConflatePolicy
+)
+
+// ErrConflateUnsupported is returned when subscribing with ConflatePolicy to
+// a feed whose notifications cannot be merged.
+var ErrConflateUnsupported = errors.New("Spiral feed does not support ConflatePolicy")
+
+// FeedOptions configures the buffering of a subscription feed. Without
+// options a feed is unbuffered and uses BlockPolicy.
+type FeedOptions struct {
+	Buffer int            // notifications buffered for the consumer
+	Policy overflowPolicy // behaviour once Buffer notifications are waiting
+}
+
+// FeedStats reports the state of a subscription feed.
+type FeedStats struct {
+	Key      string // feed and symbol, ie. ticker:ETHBTC
+	Buffered int    // notifications waiting for the consumer
+	Dropped  uint64 // notifications discarded or merged by the overflow policy or the client inbox, or not converted
+}
+
+func feedOptions(opts []FeedOptions) FeedOptions {
+	if len(opts) == 0 {
+		return FeedOptions{}
+	}
+	return opts[0]
+}
+
+// feedQueue buffers the notifications of a feed according to its overflow policy.
+type feedQueue struct {
+	dropped uint64 // accessed atomically, kept first for alignment
+
+	mu     sync.Mutex
+	items  []interface{}
+	size   int
+	policy overflowPolicy
+	merge  func(prev, next interface{}) (interface{}, bool)
+
+	ready chan struct{} // signalled once an item is queued
+	space chan struct{} // signalled once an item is taken
+}
+
+func newFeedQueue(opts FeedOptions, merge func(prev, next interface{}) (interface{}, bool)) *feedQueue {
+	size := opts.Buffer
+	if size < 1 {
+		size = 1 // handed over to the feed goroutine, as with an unbuffered channel
+	}
+	return &feedQueue{
+		size:   size,
+		policy: opts.Policy,
+		merge:  merge,
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push queues msg according to the overflow policy, waiting for room with
+// BlockPolicy until done. It returns false when msg was discarded.
+func (q *feedQueue) push(msg interface{}, done <-chan struct{}) bool {
+	q.mu.Lock()
+	switch q.policy {
+	case ConflatePolicy:
+		if n := len(q.items); n > 0 && q.merge != nil {
+			if merged, ok := q.merge(q.items[n-1], msg); ok {
+				q.items[n-1] = merged
+				atomic.AddUint64(&q.dropped, 1)
+				q.mu.Unlock()
+				return true
+			}
+		}
+		fallthrough
+	case DropOldestPolicy:
+		if len(q.items) >= q.size {
+			q.items = q.items[1:]
+			atomic.AddUint64(&q.dropped, 1)
+		}
+	case DropNewestPolicy:
+		if len(q.items) >= q.size {
+			atomic.AddUint64(&q.dropped, 1)
+			q.mu.Unlock()
+			return false
+		}
+	default:
+		for len(q.items) >= q.size {
+			q.mu.Unlock()
+			select {
+			case <-q.space:
+			case <-done:
+				return false
+			}
+			q.mu.Lock()
+		}
+	}
+	q.items = append(q.items, msg)
+	q.mu.Unlock()
+	signal(q.ready)
+	return true
+}
+
+// pop returns the oldest queued item, waiting for one until done.
+func (q *feedQueue) pop(done <-chan struct{}) (interface{}, bool) {
+	q.mu.Lock()
+	for len(q.items) == 0 {
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-done:
+			return nil, false
+		}
+		q.mu.Lock()
+	}
+	msg := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.mu.Unlock()
+	signal(q.space)
+	return msg, true
+}
+
+func (q *feedQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// feed forwards the notifications of one subscription to its consumer channels.
+//
+// The consumer channels are owned by the feed goroutine: they are written and
+// closed by it only, so notifications can never be sent on a closed channel.
+type feed struct {
+	key string
+
+	queue   *feedQueue
+	deliver func(msg interface{}, done <-chan struct{}) bool // false when done
+	closeCh func()
+
+	// typed consumer channels, ie. <-chan WSNotificationTickerResponse
+	updates   interface{}
+	snapshots interface{}
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+func newFeed(key string, queue *feedQueue, deliver func(msg interface{}, done <-chan struct{}) bool, closeCh func()) *feed {
+	return &feed{
+		key:     key,
+		queue:   queue,
+		deliver: deliver,
+		closeCh: closeCh,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (f *feed) run() {
+	defer close(f.stopped)
+	defer f.closeCh()
+	for {
+		msg, ok := f.queue.pop(f.done)
+		if !ok || !f.deliver(msg, f.done) {
+			return
+		}
+	}
+}
+
+// push queues msg for delivery according to the feed overflow policy.
+func (f *feed) push(msg interface{}) {
+	f.queue.push(msg, f.done)
+}
+
+// discard counts a notification that never reached the consumer.
+func (f *feed) discard() {
+	atomic.AddUint64(&f.queue.dropped, 1)
+}
+
+// close stops the feed and waits for its consumer channels to be closed.
+func (f *feed) close() {
+	f.closeOnce.Do(func() { close(f.done) })
+	<-f.stopped
+}
+
+func (f *feed) stats() FeedStats {
+	return FeedStats{
+		Key:      f.key,
+		Buffered: f.queue.len(),
+		Dropped:  atomic.LoadUint64(&f.queue.dropped),
+	}
+}
+
+// feedRegistry holds the feeds of a client by subscription key, one per
+// subscription handle. It is safe for concurrent use by subscribers and the
+// notification handler.
+type feedRegistry struct {
+	mu    sync.RWMutex
+	feeds map[string][]*feed
+}
+
+func newFeedRegistry() *feedRegistry {
+	return &feedRegistry{feeds: make(map[string][]*feed)}
+}
+
+// add registers and starts the feed built by create under key. first reports
+// whether it is the only feed of key. Feeds without a merge function are not
+// registered with ConflatePolicy.
+func (r *feedRegistry) add(key string, opts FeedOptions, create func(key string, opts FeedOptions) *feed) (f *feed, first bool, err error) {
+	f = create(key, opts)
+	if opts.Policy == ConflatePolicy && f.queue.merge == nil {
+		return nil, false, ErrConflateUnsupported
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.feeds[key] = append(r.feeds[key], f)
+	go f.run()
+	return f, len(r.feeds[key]) == 1, nil
+}
+
+// remove unregisters and closes f. found reports whether f was registered
+// and last whether it was the last feed of its key.
+func (r *feedRegistry) remove(f *feed) (found, last bool) {
+	r.mu.Lock()
+	feeds := r.feeds[f.key]
+	for i, registered := range feeds {
+		if registered == f {
+			found = true
+			feeds = append(feeds[:i:i], feeds[i+1:]...)
+			break
+		}
+	}
+	if len(feeds) == 0 {
+		delete(r.feeds, f.key)
+	} else {
+		r.feeds[f.key] = feeds
+	}
+	r.mu.Unlock()
+
+	if found {
+		f.close()
+	}
+	return found, found && len(feeds) == 0
+}
+
+// contains reports whether f is registered.
+func (r *feedRegistry) contains(f *feed) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, registered := range r.feeds[f.key] {
+		if registered == f {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch hands msg to every feed registered under key. Messages for feeds
+// nobody subscribed to are dropped.
+func (r *feedRegistry) dispatch(key string, msg interface{}) {
+	r.mu.RLock()
+	feeds := r.feeds[key]
+	r.mu.RUnlock()
+
+	for _, f := range feeds {
+		f.push(msg)
+	}
+}
+
+// drop counts a notification for key discarded before reaching its feeds.
+func (r *feedRegistry) drop(key string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.feeds[key] {
+		f.discard()
+	}
+}
+
+// closeAll unregisters and closes every feed.
+func (r *feedRegistry) closeAll() {
+	r.mu.Lock()
+	feeds := r.feeds
+	r.feeds = make(map[string][]*feed)
+	r.mu.Unlock()
+
+	for _, fs := range feeds {
+		for _, f := range fs {
+			f.close()
+		}
+	}
+}
+
+func (r *feedRegistry) stats() []FeedStats {
+	r.mu.RLock()
+	stats := make([]FeedStats, 0, len(r.feeds))
+	for _, fs := range r.feeds {
+		for _, f := range fs {
+			stats = append(stats, f.stats())
+		}
+	}
+	r.mu.RUnlock()
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// mergeTickers conflates tickers, the latest one replacing the previous one.
+func mergeTickers(prev, next interface{}) (interface{}, bool) {
+	_, ok := next.(WSNotificationTickerResponse)
+	return next, ok
+}
+
+// mergeOrderbook conflates order book notifications: a snapshot replaces
+// anything before it and updates are merged level by level.
+func mergeOrderbook(prev, next interface{}) (interface{}, bool) {
+	switch n := next.(type) {
+	case WSNotificationOrderbookSnapshot:
+		return n, true
+	case WSNotificationOrderbookUpdate:
+		switch p := prev.(type) {
+		case WSNotificationOrderbookSnapshot:
+			p.Ask = mergeLevels(p.Ask, n.Ask, true)
+			p.Bid = mergeLevels(p.Bid, n.Bid, true)
+			p.Sequence = n.Sequence
+			return p, true
+		case WSNotificationOrderbookUpdate:
+			p.Ask = mergeLevels(p.Ask, n.Ask, false)
+			p.Bid = mergeLevels(p.Bid, n.Bid, false)
+			p.Sequence = n.Sequence
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// mergeLevels applies the levels of next over prev. Levels of size 0 are
+// removed when merging into a snapshot and kept as removals otherwise.
+func mergeLevels(prev, next []WSSubtypeTrade, snapshot bool) []WSSubtypeTrade {
+	merged := make([]WSSubtypeTrade, 0, len(prev)+len(next))
+	index := make(map[string]int, len(prev)+len(next))
+	for _, level := range append(append([]WSSubtypeTrade(nil), prev...), next...) {
+		price := level.Price.Rat().RatString()
+		if i, ok := index[price]; ok {
+			merged[i] = level
+			continue
+		}
+		index[price] = len(merged)
+		merged = append(merged, level)
+	}
+	if !snapshot {
+		return merged
+	}
+
+	kept := merged[:0]
+	for _, level := range merged {
+		if !level.Size.IsZero() {
+			kept = append(kept, level)
+		}
+	}
+	return kept
+}
+
+func tickerFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan WSNotificationTickerResponse)
+	f := newFeed(key, newFeedQueue(opts, mergeTickers), func(msg interface{}, done <-chan struct{}) bool {
+		select {
+		case updates <- msg.(WSNotificationTickerResponse):
+			return true
+		case <-done:
+			return false
+		}
+	}, func() { close(updates) })
+	f.updates = (<-chan WSNotificationTickerResponse)(updates)
+	return f
+}
+
+func orderbookFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan WSNotificationOrderbookUpdate)
+	snapshots := make(chan WSNotificationOrderbookSnapshot)
+	f := newFeed(key, newFeedQueue(opts, mergeOrderbook), func(msg interface{}, done <-chan struct{}) bool {
+		switch m := msg.(type) {
+		case WSNotificationOrderbookUpdate:
+			select {
+			case updates <- m:
+				return true
+			case <-done:
+				return false
+			}
+		case WSNotificationOrderbookSnapshot:
+			select {
+			case snapshots <- m:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		return true
+	}, func() {
+		close(updates)
+		close(snapshots)
+	})
+	f.updates = (<-chan WSNotificationOrderbookUpdate)(updates)
+	f.snapshots = (<-chan WSNotificationOrderbookSnapshot)(snapshots)
+	return f
+}
+
+func tradesFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan WSNotificationTradesUpdate)
+	snapshots := make(chan WSNotificationTradesSnapshot)
+	f := newFeed(key, newFeedQueue(opts, nil), func(msg interface{}, done <-chan struct{}) bool {
+		switch m := msg.(type) {
+		case WSNotificationTradesUpdate:
+			select {
+			case updates <- m:
+				return true
+			case <-done:
+				return false
+			}
+		case WSNotificationTradesSnapshot:
+			select {
+			case snapshots <- m:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		return true
+	}, func() {
+		close(updates)
+		close(snapshots)
+	})
+	f.updates = (<-chan WSNotificationTradesUpdate)(updates)
+	f.snapshots = (<-chan WSNotificationTradesSnapshot)(snapshots)
+	return f
+}
+
+func candlesFeed(key string, opts FeedOptions) *feed {
+	updates := make(chan WSNotificationCandlesUpdate)
+	snapshots := make(chan WSNotificationCandlesSnapshot)
+	f := newFeed(key, newFeedQueue(opts, nil), func(msg interface{}, done <-chan struct{}) bool {
+		switch m := msg.(type) {
+		case WSNotificationCandlesUpdate:
+			select {
+			case updates <- m:
+				return true
+			case <-done:
+				return false
+			}
+		case WSNotificationCandlesSnapshot:
+			select {
+			case snapshots <- m:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		return true
+	}, func() {
+		close(updates)
+		close(snapshots)
+	})
+	f.updates = (<-chan WSNotificationCandlesUpdate)(updates)
+	f.snapshots = (<-chan WSNotificationCandlesSnapshot)(snapshots)
+	return f
+}
@@ -0,0 +1,289 @@
+package spiral
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// drain calls read in the background of wg until it returns false, once the
+// channel it reads is closed.
+func drain(wg *sync.WaitGroup, read func() bool) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for read() {
+		}
+	}()
+}
+
+// The registry is used at once by subscribers, unsubscribers, the dispatcher
+// and Close. Run with -race.
+func TestFeedRegistryConcurrency(t *testing.T) {
+	r := newFeedRegistry()
+	keys := []string{"ticker:A", "ticker:B", "ticker:C"}
+	stop := make(chan struct{})
+
+	var dispatchers sync.WaitGroup
+	for _, key := range keys {
+		dispatchers.Add(1)
+		go func(key string) {
+			defer dispatchers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					r.dispatch(key, WSNotificationTickerResponse{Symbol: key})
+				}
+			}
+		}(key)
+	}
+
+	var subscribers, readers sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		subscribers.Add(1)
+		go func(i int) {
+			defer subscribers.Done()
+			for j := 0; j < 50; j++ {
+				opts := FeedOptions{Buffer: j % 4, Policy: overflowPolicy(j % 4)}
+				f, _, _ := r.add(keys[(i+j)%len(keys)], opts, tickerFeed)
+				updates := f.updates.(<-chan WSNotificationTickerResponse)
+				drain(&readers, func() bool {
+					_, ok := <-updates
+					return ok
+				})
+				r.stats()
+				if j%3 != 0 {
+					r.remove(f)
+				}
+			}
+		}(i)
+	}
+
+	subscribers.Wait()
+	r.closeAll()
+	close(stop)
+	dispatchers.Wait()
+	waitGroup(t, &readers, "feeds closed by closeAll")
+	if stats := r.stats(); len(stats) != 0 {
+		t.Errorf("%d feeds left after closeAll", len(stats))
+	}
+}
+
+// Subscribing and closing handles while notifications are dispatched and the
+// client is closed must neither race nor leave a channel open. Run with -race.
+func TestWSClientConcurrentSubscriptions(t *testing.T) {
+	server := newRPCServer(t)
+	client, err := NewWSClientWithConfig(WSConfig{URL: server.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := client.SubscribeTicker("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var notifier sync.WaitGroup
+	notifier.Add(1)
+	go func() {
+		defer notifier.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			server.notify("ticker", "subscribeTicker", map[string]interface{}{"symbol": "A", "last": fmt.Sprint(i)})
+			server.notify("updateOrderbook", "subscribeTicker", map[string]interface{}{"symbol": "A", "sequence": i})
+			time.Sleep(50 * time.Microsecond)
+		}
+	}()
+
+	var subscribers, readers sync.WaitGroup
+	drain(&readers, func() bool {
+		_, ok := <-first.Updates
+		return ok
+	})
+	for i := 0; i < 8; i++ {
+		subscribers.Add(1)
+		go func(i int) {
+			defer subscribers.Done()
+			for j := 0; j < 20; j++ {
+				ticker, err := client.SubscribeTicker("A", FeedOptions{Buffer: j % 3, Policy: overflowPolicy(j % 4)})
+				if err != nil {
+					return // closed
+				}
+				book, err := client.SubscribeOrderbook("A")
+				if err != nil {
+					return
+				}
+				drain(&readers, func() bool {
+					_, ok := <-ticker.Updates
+					return ok
+				})
+				drain(&readers, func() bool {
+					select {
+					case _, ok := <-book.Updates:
+						return ok
+					case _, ok := <-book.Snapshots:
+						return ok
+					}
+				})
+				client.FeedStats()
+				if j%2 == 0 {
+					ticker.Close()
+					book.Close()
+				}
+			}
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	client.Close() // concurrently with the subscribers
+	subscribers.Wait()
+	close(stop)
+	notifier.Wait()
+	waitGroup(t, &readers, "subscriptions closed by Close")
+
+	if _, err := client.SubscribeTicker("A"); err == nil {
+		t.Error("SubscribeTicker after Close succeeded")
+	}
+	if err := first.Close(); err != nil {
+		t.Errorf("closing a subscription after Close: %v", err)
+	}
+}
+
+// Same as TestWSClientConcurrentSubscriptions on a pool sharing its registry
+// across connections.
+func TestWSPoolConcurrentSubscriptions(t *testing.T) {
+	server := newRPCServer(t)
+	pool, err := NewWSPool(WSPoolConfig{WSConfig: WSConfig{URL: server.url()}, Connections: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subscribers, readers sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		subscribers.Add(1)
+		go func(i int) {
+			defer subscribers.Done()
+			for j := 0; j < 20; j++ {
+				symbol := fmt.Sprint("S", (i+j)%5)
+				ticker, err := pool.SubscribeTicker(symbol)
+				if err != nil {
+					return
+				}
+				drain(&readers, func() bool {
+					_, ok := <-ticker.Updates
+					return ok
+				})
+				server.notify("ticker", "subscribeTicker", map[string]interface{}{"symbol": symbol})
+				pool.Load()
+				if j%2 == 0 {
+					ticker.Close()
+				}
+			}
+		}(i)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	pool.Close()
+	subscribers.Wait()
+	waitGroup(t, &readers, "subscriptions closed by Close")
+}
+
+func waitGroup(t *testing.T, wg *sync.WaitGroup, what string) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// Notifications dropped by a full inbox are counted by the feeds they were for.
+func TestInboxDropsAttributedToFeeds(t *testing.T) {
+	h := &responseChannels{
+		feeds: newFeedRegistry(),
+		inbox: newFeedQueue(FeedOptions{Buffer: 2, Policy: DropNewestPolicy}, nil),
+	}
+	a, _, _ := h.feeds.add("ticker:A", FeedOptions{}, tickerFeed)
+	a2, _, _ := h.feeds.add("ticker:A", FeedOptions{}, tickerFeed)
+	b, _, _ := h.feeds.add("ticker:B", FeedOptions{}, tickerFeed)
+	defer h.feeds.closeAll()
+
+	// nothing dispatches: the inbox fills up
+	h.enqueue("ticker:B", WSNotificationTickerResponse{Symbol: "B"})
+	h.enqueue("ticker:B", WSNotificationTickerResponse{Symbol: "B"})
+	for i := 0; i < 3; i++ {
+		h.enqueue("ticker:A", WSNotificationTickerResponse{Symbol: "A"})
+	}
+	h.enqueue("ticker:C", WSNotificationTickerResponse{Symbol: "C"})
+
+	for _, c := range []struct {
+		f    *feed
+		want uint64
+	}{{a, 3}, {a2, 3}, {b, 0}} {
+		if got := c.f.stats().Dropped; got != c.want {
+			t.Errorf("%s dropped %d, want %d", c.f.key, got, c.want)
+		}
+	}
+}
+
+// Trades and candles cannot be conflated without losing some of them.
+func TestConflateUnsupported(t *testing.T) {
+	conflate := FeedOptions{Policy: ConflatePolicy}
+	rpc := newRPCServer(t)
+	client, err := NewWSClientWithConfig(WSConfig{URL: rpc.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	pool, err := NewWSPool(WSPoolConfig{WSConfig: WSConfig{URL: rpc.url()}, Connections: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	stream, err := NewStreamClient(WSConfig{URL: newStreamServer(t).url(), CallTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	for name, subscribe := range map[string]func() error{
+		"WSClient trades":     func() error { _, err := client.SubscribeTrades("A", conflate); return err },
+		"WSClient candles":    func() error { _, err := client.SubscribeCandles("A", Interval1Minute, conflate); return err },
+		"WSClient reports":    func() error { _, err := client.SubscribeReports(conflate); return err },
+		"WSPool trades":       func() error { _, err := pool.SubscribeTrades("A", conflate); return err },
+		"WSPool candles":      func() error { _, err := pool.SubscribeCandles("A", Interval1Minute, conflate); return err },
+		"StreamClient trades": func() error { _, err := stream.StreamTrades("A", conflate); return err },
+		"StreamClient candles": func() error {
+			_, err := stream.StreamCandles("A", Period1Minute, conflate)
+			return err
+		},
+	} {
+		if err := subscribe(); errors.Cause(err) != ErrConflateUnsupported {
+			t.Errorf("%s with ConflatePolicy = %v", name, err)
+		}
+	}
+	if n := len(client.FeedStats()) + len(stream.FeedStats()); n != 0 {
+		t.Errorf("%d feeds registered", n)
+	}
+
+	if _, err := client.SubscribeTicker("A", conflate); err != nil {
+		t.Errorf("SubscribeTicker with ConflatePolicy = %v", err)
+	}
+	if _, err := stream.StreamBook("A", conflate); err != nil {
+		t.Errorf("StreamBook with ConflatePolicy = %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package spiral
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/juju/errors"
+)
+
+// WSNewOrderRequest is the request type to place an order on websocket.
+type WSNewOrderRequest struct {
+	ClientOrderID string    `json:"clientOrderId,required"`
+	Symbol        string    `json:"symbol,required"`
+	Side          string    `json:"side,required"`
+	Type          orderType `json:"type,omitempty"`
+	Price         string    `json:"price,omitempty"`
+	Quantity      string    `json:"quantity,required"`
+}
+
+// WSReplaceOrderRequest is the request type to replace an order on websocket.
+type WSReplaceOrderRequest struct {
+	ClientOrderID   string `json:"clientOrderId,required"`
+	RequestClientID string `json:"requestClientId,required"`
+	Quantity        string `json:"quantity,required"`
+	Price           string `json:"price,required"`
+}
+
+// WSCancelOrderRequest is the request type to cancel an order on websocket.
+type WSCancelOrderRequest struct {
+	ClientOrderID string `json:"clientOrderId,required"`
+}
+
+// Order converts the report to the order model of the REST API.
+func (r WSOrderReport) Order() Orders {
+	return Orders{
+		Id:             r.ID,
+		ClientOrderId:  r.ClientOrderID,
+		Symbol:         r.Symbol,
+		Side:           r.Side,
+		Price:          r.Price,
+		Quantity:       r.Quantity,
+		FilledQuantity: r.CumQuantity,
+		Type:           r.Type,
+		Status:         r.Status,
+		CreateTime:     r.CreatedAt,
+		UpdateTime:     r.UpdatedAt,
+	}
+}
+
+// PlaceOrder places an order like Spiral.PlaceOrder does on REST. A client
+// order id is generated when order has none. Login must be called first.
+func (c *WSClient) PlaceOrder(order Orders) (Orders, error) {
+	request := WSNewOrderRequest{
+		ClientOrderID: order.ClientOrderId,
+		Symbol:        order.Symbol,
+		Type:          order.Type,
+		Quantity:      FormatAmount(order.Quantity),
+	}
+	if request.ClientOrderID == "" {
+		id, err := randomID()
+		if err != nil {
+			return Orders{}, errors.Annotate(err, "Spiral PlaceOrder")
+		}
+		request.ClientOrderID = id
+	}
+	switch order.Side {
+	case BidSide:
+		request.Side = "buy"
+	case AskSide:
+		request.Side = "sell"
+	default:
+		return Orders{}, errors.Errorf("Spiral PlaceOrder: unknown side %q", order.Side)
+	}
+	if order.Type != MarketOrderType {
+		request.Price = FormatAmount(order.Price)
+	}
+
+	var response WSOrderReport
+	if err := c.call("newOrder", request, &response); err != nil {
+		return Orders{}, errors.Annotate(err, "Spiral PlaceOrder")
+	}
+	return response.Order(), nil
+}
+
+// ReplaceOrder replaces the order clientOrderID by a new one identified by
+// newClientOrderID with the given quantity and price.
+func (c *WSClient) ReplaceOrder(clientOrderID, newClientOrderID string, quantity, price float64) (Orders, error) {
+	request := WSReplaceOrderRequest{
+		ClientOrderID:   clientOrderID,
+		RequestClientID: newClientOrderID,
+		Quantity:        FormatAmount(quantity),
+		Price:           FormatAmount(price),
+	}
+
+	var response WSOrderReport
+	if err := c.call("cancelReplaceOrder", request, &response); err != nil {
+		return Orders{}, errors.Annotate(err, "Spiral ReplaceOrder")
+	}
+	return response.Order(), nil
+}
+
+// CancelOrder cancels the order clientOrderID and returns its final state.
+func (c *WSClient) CancelOrder(clientOrderID string) (Orders, error) {
+	request := WSCancelOrderRequest{ClientOrderID: clientOrderID}
+
+	var response WSOrderReport
+	if err := c.call("cancelOrder", request, &response); err != nil {
+		return Orders{}, errors.Annotate(err, "Spiral CancelOrder")
+	}
+	return response.Order(), nil
+}
+
+// GetActiveOrders obtains your active orders.
+func (c *WSClient) GetActiveOrders() ([]Orders, error) {
+	var response []WSOrderReport
+	if err := c.call("getOrders", struct{}{}, &response); err != nil {
+		return nil, errors.Annotate(err, "Spiral GetActiveOrders")
+	}
+
+	orders := make([]Orders, len(response))
+	for i, r := range response {
+		orders[i] = r.Order()
+	}
+	return orders, nil
+}
+
+// randomID returns 32 random hexadecimal characters.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
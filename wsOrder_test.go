@@ -0,0 +1,39 @@
+package spiral
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPlaceOrderKeepsPrecision(t *testing.T) {
+	server := newRPCServer(t)
+	client, err := NewWSClientWithConfig(WSConfig{URL: server.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server.handle(func(method string, params json.RawMessage) (interface{}, *rpcError) {
+		return map[string]interface{}{"clientOrderId": "a"}, nil
+	})
+
+	// %.8f would send 0.00000000 and round the price, the float sum must not
+	// be sent as 0.30000000000000004
+	order := Orders{ClientOrderId: "a", Symbol: "SHIBUSDT", Side: BidSide, Type: LimitOrderType, Quantity: 0.000000001, Price: 0.1 + 0.2}
+	if _, err := client.PlaceOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	var request WSNewOrderRequest
+	json.Unmarshal(server.lastParams("newOrder"), &request)
+	if request.Quantity != "0.000000001" || request.Price != "0.3" {
+		t.Errorf("quantity %q, price %q", request.Quantity, request.Price)
+	}
+
+	if _, err := client.ReplaceOrder("a", "b", 1e-9, 12345678.9); err != nil {
+		t.Fatal(err)
+	}
+	var replace WSReplaceOrderRequest
+	json.Unmarshal(server.lastParams("cancelReplaceOrder"), &replace)
+	if replace.Quantity != "0.000000001" || replace.Price != "12345678.9" {
+		t.Errorf("replace quantity %q, price %q", replace.Quantity, replace.Price)
+	}
+}
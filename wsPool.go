@@ -0,0 +1,487 @@
+package spiral
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+const wsPoolConnections = 2 // default number of connections of a WSPool
+
+// ErrWSPoolFull is returned when every connection of a WSPool reached its
+// subscription cap.
+var ErrWSPoolFull = errors.New("Spiral websocket pool full")
+
+// WSPoolConfig configures a WSPool.
+type WSPoolConfig struct {
+	WSConfig // configuration of every connection
+
+	Connections      int // number of connections, 2 by default
+	MaxSubscriptions int // server subscriptions per connection, unlimited when 0
+}
+
+// WSPool spreads WebSocket market data subscriptions across several
+// connections.
+//
+// Each feed is carried by the least loaded connection when first subscribed.
+// When a connection drops its feeds move to the other connections, and once it
+// is restored feeds move back to it until the load is even. Subscription
+// handles are not affected by these moves, though a moved feed may repeat a
+// few notifications and starts again with a snapshot.
+//
+// The pool carries tickers, order books, trades and candles. Order reports
+// and balances need a logged in session, subscribe to them on a WSClient.
+// The pool is terminated by Close, or once every connection gave up
+// reconnecting as set by WSConfig.
+type WSPool struct {
+	config  WSPoolConfig
+	clients []*WSClient
+	feeds   *feedRegistry
+	errs    chan error
+	events  chan ConnectionEvent
+
+	subMu sync.Mutex // serialises the changes of feeds, held over calls bounded by CallTimeout
+
+	mu      sync.Mutex // guards healthy and entries, never held over network calls
+	healthy []bool
+	entries map[string]*poolEntry
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error // cause of the termination, set before closed is closed
+}
+
+// poolEntry is a feed of the pool and the connection carrying it.
+type poolEntry struct {
+	req    feedRequest
+	client int
+}
+
+// NewWSPool connects a pool of WebSocket connections.
+func NewWSPool(cfg WSPoolConfig) (*WSPool, error) {
+	if cfg.Connections == 0 {
+		cfg.Connections = wsPoolConnections
+	}
+	if cfg.Connections < 0 || cfg.MaxSubscriptions < 0 {
+		return nil, errors.New("Spiral NewWSPool: negative connections or subscriptions")
+	}
+	conn, err := cfg.WSConfig.withDefaults()
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral NewWSPool")
+	}
+	cfg.WSConfig = conn
+
+	p := &WSPool{
+		config:  cfg,
+		feeds:   newFeedRegistry(),
+		errs:    make(chan error, 16),
+		events:  make(chan ConnectionEvent, 16),
+		healthy: make([]bool, cfg.Connections),
+		entries: make(map[string]*poolEntry),
+		closed:  make(chan struct{}),
+	}
+	for i := 0; i < cfg.Connections; i++ {
+		c, err := newWSClient(cfg.WSConfig, p.feeds, p.errs)
+		if err != nil {
+			p.Close()
+			return nil, errors.Annotate(err, "Spiral NewWSPool")
+		}
+		p.clients = append(p.clients, c)
+		p.healthy[i] = true
+	}
+	for i, c := range p.clients {
+		go p.watch(i, c)
+	}
+	return p, nil
+}
+
+// Close closes every connection of the pool.
+//
+// Every subscribed channel is closed before Close returns.
+func (p *WSPool) Close() {
+	p.terminate(ErrWSClientClosed)
+}
+
+// terminate closes the pool for good, recording cause as its Err.
+func (p *WSPool) terminate(cause error) {
+	p.closeOnce.Do(func() {
+		p.err = cause
+		close(p.closed)
+	})
+	for _, c := range p.clients {
+		c.Close()
+	}
+	p.feeds.closeAll()
+}
+
+// Done returns a channel closed once the pool is terminated, either by Close
+// or because every connection gave up reconnecting.
+func (p *WSPool) Done() <-chan struct{} {
+	return p.closed
+}
+
+// Err returns the cause of the termination once Done is closed, nil before.
+func (p *WSPool) Err() error {
+	select {
+	case <-p.closed:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+// Errors returns the channel reporting the errors of every connection, like
+// WSClient.Errors.
+func (p *WSPool) Errors() <-chan error {
+	return p.errs
+}
+
+// ConnectionEvents returns the channel notifying the state changes of every
+// connection, identified by ConnectionEvent.Connection. Events are dropped
+// when the channel is not read.
+func (p *WSPool) ConnectionEvents() <-chan ConnectionEvent {
+	return p.events
+}
+
+// FeedStats returns the buffering state of every subscribed feed.
+func (p *WSPool) FeedStats() []FeedStats {
+	return p.feeds.stats()
+}
+
+// Load returns the number of server subscriptions of each connection.
+func (p *WSPool) Load() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load()
+}
+
+// SubscribeTicker subscribes to the specified market ticker notifications.
+func (p *WSPool) SubscribeTicker(symbol string, opts ...FeedOptions) (*TickerSubscription, error) {
+	s, err := p.subscribe(tickerRequest(symbol), feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral SubscribeTicker")
+	}
+	return newTickerSubscription(s), nil
+}
+
+// SubscribeTrades subscribes to the specified market trades notifications.
+func (p *WSPool) SubscribeTrades(symbol string, opts ...FeedOptions) (*TradesSubscription, error) {
+	s, err := p.subscribe(tradesRequest(symbol), feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral SubscribeTrades")
+	}
+	return newTradesSubscription(s), nil
+}
+
+// SubscribeOrderbook subscribes to the specified market order book notifications.
+func (p *WSPool) SubscribeOrderbook(symbol string, opts ...FeedOptions) (*OrderbookSubscription, error) {
+	s, err := p.subscribe(orderbookRequest(symbol), feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral SubscribeOrderbook")
+	}
+	return newOrderbookSubscription(s), nil
+}
+
+// SubscribeCandles subscribes to the specified market candle notifications for the specified timeframe.
+func (p *WSPool) SubscribeCandles(symbol string, timeframe interval, opts ...FeedOptions) (*CandlesSubscription, error) {
+	s, err := p.subscribe(candlesRequest(symbol, timeframe), feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral SubscribeCandles")
+	}
+	return newCandlesSubscription(s), nil
+}
+
+// StreamBook subscribes to the order book of symbol in the transport independent model.
+func (p *WSPool) StreamBook(symbol string, opts ...FeedOptions) (*BookStream, error) {
+	req := orderbookRequest(symbol)
+	req.create = bookFeed
+	s, err := p.subscribe(req, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamBook")
+	}
+	return newBookStream(s), nil
+}
+
+// StreamTrades subscribes to the trades of symbol in the transport independent model.
+func (p *WSPool) StreamTrades(symbol string, opts ...FeedOptions) (*TradeStream, error) {
+	req := tradesRequest(symbol)
+	req.create = marketTradesFeed
+	s, err := p.subscribe(req, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamTrades")
+	}
+	return newTradeStream(s), nil
+}
+
+// StreamCandles subscribes to the candles of symbol and period p in the
+// transport independent model.
+func (p *WSPool) StreamCandles(symbol string, period Period, opts ...FeedOptions) (*CandleStream, error) {
+	timeframe := period.interval()
+	if timeframe == "" {
+		return nil, errors.Errorf("Spiral StreamCandles: period %q not streamed", string(period))
+	}
+	req := candlesRequest(symbol, timeframe)
+	req.create = candleFeed
+	s, err := p.subscribe(req, feedOptions(opts))
+	if err != nil {
+		return nil, errors.Annotate(err, "Spiral StreamCandles")
+	}
+	return newCandleStream(s), nil
+}
+
+// subscribe registers a new feed for req, opening it on the least loaded
+// connection if it is the first one.
+func (p *WSPool) subscribe(req feedRequest, opts FeedOptions) (*Subscription, error) {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+
+	select {
+	case <-p.closed:
+		return nil, ErrWSClientClosed
+	default:
+	}
+
+	f, first, err := p.feeds.add(req.key, opts, req.create)
+	if err != nil {
+		return nil, err
+	}
+	if first {
+		i, err := p.open(req, -1)
+		if err != nil {
+			p.feeds.remove(f)
+			return nil, err
+		}
+		p.mu.Lock()
+		p.entries[req.key] = &poolEntry{req: req, client: i}
+		p.mu.Unlock()
+	}
+	return &Subscription{owner: p, feed: f}, nil
+}
+
+// release unregisters f, closing it on its connection if it was the last
+// feed of its key.
+func (p *WSPool) release(f *feed) error {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+
+	found, last := p.feeds.remove(f)
+	if !found || !last {
+		return nil
+	}
+	p.mu.Lock()
+	e, ok := p.entries[f.key]
+	delete(p.entries, f.key)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return e.req.unsubscribe(p.clients[e.client])
+}
+
+// resync subscribes again to the feed of f on the connection carrying it.
+func (p *WSPool) resync(f *feed) error {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+
+	p.mu.Lock()
+	e, ok := p.entries[f.key]
+	p.mu.Unlock()
+	if !ok || !p.feeds.contains(f) {
+		return ErrSubscriptionClosed
+	}
+	return e.req.subscribe(p.clients[e.client])
+}
+
+// open subscribes req on the least loaded healthy connection other than
+// skip, returning its index. The caller holds subMu.
+func (p *WSPool) open(req feedRequest, skip int) (int, error) {
+	p.mu.Lock()
+	load := p.load()
+	best := -1
+	for i := range p.clients {
+		if i == skip || !p.healthy[i] || p.full(load[i]) {
+			continue
+		}
+		if best < 0 || load[i] < load[best] {
+			best = i
+		}
+	}
+	p.mu.Unlock()
+
+	if best < 0 {
+		return -1, ErrWSPoolFull
+	}
+	if err := req.subscribe(p.clients[best]); err != nil {
+		return -1, err
+	}
+	return best, nil
+}
+
+func (p *WSPool) full(load int) bool {
+	return p.config.MaxSubscriptions > 0 && load >= p.config.MaxSubscriptions
+}
+
+// load counts the feeds carried by each connection. The caller holds mu.
+func (p *WSPool) load() []int {
+	load := make([]int, len(p.clients))
+	for _, e := range p.entries {
+		load[e.client]++
+	}
+	return load
+}
+
+// carried returns the entries of the feeds carried by connection i.
+func (p *WSPool) carried(i int) []*poolEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var entries []*poolEntry
+	for _, e := range p.entries {
+		if e.client == i {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// watch forwards the events of connection i and rebalances the feeds when
+// it drops or is restored. A connection that gave up reconnecting has its
+// feeds moved for good, the pool terminating with the last one.
+func (p *WSPool) watch(i int, c *WSClient) {
+	for {
+		select {
+		case ev := <-c.ConnectionEvents():
+			ev.Connection = i
+			select {
+			case p.events <- ev:
+			default:
+			}
+			switch ev.State {
+			case DisconnectedState:
+				p.evacuate(i)
+			case ResubscribedState:
+				p.restore(i)
+			}
+		case <-c.Done():
+			select {
+			case <-p.closed:
+				return
+			default:
+			}
+			if p.gone() {
+				p.terminate(errors.Annotate(c.Err(), "Spiral WSPool: every connection gave up"))
+				return
+			}
+			p.report(errors.Annotatef(c.Err(), "Spiral WSPool connection %d", i))
+			p.evacuate(i)
+			for _, e := range p.carried(i) {
+				p.report(errors.Errorf("Spiral WSPool: %s lost with connection %d", e.req.key, i))
+			}
+			return
+		}
+	}
+}
+
+// gone reports whether every connection is terminated.
+func (p *WSPool) gone() bool {
+	for _, c := range p.clients {
+		select {
+		case <-c.Done():
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// evacuate moves the feeds of the dropped connection i to the other ones.
+// Feeds that find no room stay on i and are restored with it, unless i gave
+// up reconnecting.
+func (p *WSPool) evacuate(i int) {
+	p.mu.Lock()
+	p.healthy[i] = false
+	p.mu.Unlock()
+
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	for _, e := range p.carried(i) {
+		j, err := p.open(e.req, i)
+		if err != nil {
+			if err != ErrWSPoolFull {
+				p.report(errors.Annotatef(err, "Spiral WSPool move %s", e.req.key))
+			}
+			continue
+		}
+		p.clients[i].forget(e.req.key) // the connection is down, only forget it
+		p.mu.Lock()
+		e.client = j
+		p.mu.Unlock()
+	}
+}
+
+// restore marks connection i healthy again, drops the feeds it restored
+// although they moved meanwhile and moves feeds back to it until the load is
+// even.
+func (p *WSPool) restore(i int) {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+
+	p.mu.Lock()
+	p.healthy[i] = true
+	var stale []string
+	for _, key := range p.clients[i].trackedKeys() {
+		if e, ok := p.entries[key]; !ok || e.client != i {
+			stale = append(stale, key)
+		}
+	}
+	p.mu.Unlock()
+	for _, key := range stale {
+		if err := p.clients[i].drop(key); err != nil {
+			p.report(errors.Annotatef(err, "Spiral WSPool drop %s", key))
+		}
+	}
+
+	for {
+		moved, from := p.surplus(i)
+		if moved == nil {
+			return
+		}
+		if err := moved.req.subscribe(p.clients[i]); err != nil {
+			p.report(errors.Annotatef(err, "Spiral WSPool move %s", moved.req.key))
+			return
+		}
+		if err := p.clients[from].drop(moved.req.key); err != nil {
+			p.report(errors.Annotatef(err, "Spiral WSPool move %s", moved.req.key))
+		}
+		p.mu.Lock()
+		moved.client = i
+		p.mu.Unlock()
+	}
+}
+
+// surplus returns a feed of the most loaded connection to move to connection
+// i and the connection carrying it, nil once the load is even.
+func (p *WSPool) surplus(i int) (*poolEntry, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	load := p.load()
+	if p.full(load[i]) {
+		return nil, -1
+	}
+	var moved *poolEntry
+	from := -1
+	for _, e := range p.entries {
+		if e.client != i && load[e.client]-load[i] > 1 && (moved == nil || load[e.client] > load[from]) {
+			moved, from = e, e.client
+		}
+	}
+	return moved, from
+}
+
+// report sends err on Errors without blocking.
+func (p *WSPool) report(err error) {
+	select {
+	case p.errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,133 @@
+package spiral
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// symbolOf returns the symbol param of a call.
+func symbolOf(params json.RawMessage) string {
+	var p struct{ Symbol string }
+	json.Unmarshal(params, &p)
+	return p.Symbol
+}
+
+func TestWSPoolMovesFeeds(t *testing.T) {
+	server := newRPCServer(t)
+	pool, err := NewWSPool(WSPoolConfig{WSConfig: WSConfig{URL: server.url()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	for _, symbol := range []string{"A", "B"} {
+		if _, err := pool.SubscribeTicker(symbol); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if load := pool.Load(); load[0] != 1 || load[1] != 1 {
+		t.Fatalf("load = %v", load)
+	}
+
+	server.disconnectConn(0)
+	timeout := time.After(5 * time.Second)
+	for restored := false; !restored; {
+		select {
+		case ev := <-pool.ConnectionEvents():
+			restored = ev.Connection == 0 && ev.State == ResubscribedState
+		case <-timeout:
+			t.Fatal("connection 0 not restored")
+		}
+	}
+
+	// the feed of connection 0 moved to connection 1 and back, in any order
+	// with the replay of the restored connection
+	eventually(t, "even load", func() bool {
+		load := pool.Load()
+		return load[0] == 1 && load[1] == 1
+	})
+	if n := server.count("unsubscribeTicker"); n < 1 {
+		t.Errorf("%d unsubscribeTicker calls, the feed moved back was not closed", n)
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for i, c := range pool.clients {
+		keys := c.trackedKeys()
+		if len(keys) != 1 || pool.entries[keys[0]].client != i {
+			t.Errorf("connection %d tracks %v", i, keys)
+		}
+	}
+}
+
+func TestWSPoolCallsOutsideLock(t *testing.T) {
+	server := newRPCServer(t)
+	release := make(chan struct{})
+	server.handle(func(method string, params json.RawMessage) (interface{}, *rpcError) {
+		if symbolOf(params) == "SLOW" {
+			<-release
+		}
+		return true, nil
+	})
+	pool, err := NewWSPool(WSPoolConfig{WSConfig: WSConfig{URL: server.url(), CallTimeout: 200 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	defer close(release)
+
+	subscribed := make(chan error, 1)
+	go func() {
+		_, err := pool.SubscribeTicker("SLOW")
+		subscribed <- err
+	}()
+	eventually(t, "subscribe call", func() bool { return server.count("subscribeTicker") == 1 })
+
+	loaded := make(chan []int, 1)
+	go func() { loaded <- pool.Load() }()
+	select {
+	case <-loaded:
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Load blocked by a pending subscription")
+	}
+
+	select {
+	case err := <-subscribed:
+		if err == nil || !strings.Contains(err.Error(), "deadline") {
+			t.Errorf("unanswered subscribe = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("unanswered subscribe did not time out")
+	}
+}
+
+func TestWSPoolDone(t *testing.T) {
+	server := newRPCServer(t)
+	pool, err := NewWSPool(WSPoolConfig{WSConfig: WSConfig{URL: server.url(), MaxReconnectAttempts: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	book, err := pool.StreamBook("ETHBTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Err() != nil {
+		t.Errorf("Err before Done = %v", pool.Err())
+	}
+
+	server.Close()
+	server.disconnect()
+	select {
+	case <-pool.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("pool not terminated once every connection gave up")
+	}
+	if err := pool.Err(); err == nil || !strings.Contains(err.Error(), "every connection gave up") {
+		t.Errorf("Err = %v", err)
+	}
+	if _, ok := <-book.Updates; ok {
+		t.Error("book open after the pool terminated")
+	}
+}
@@ -0,0 +1,174 @@
+package spiral
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// rpcCall is a JSON RPC call received by an rpcServer.
+type rpcCall struct {
+	Method string
+	Params json.RawMessage
+	conn   *websocket.Conn
+}
+
+// rpcError is the error of a JSON RPC response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcServer is a JSON RPC WebSocket server answering every call with true,
+// unless its handler answers otherwise.
+type rpcServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	conns   []*websocket.Conn
+	calls   []rpcCall
+	handler func(method string, params json.RawMessage) (interface{}, *rpcError)
+
+	wmu sync.Mutex // serialises the writes of every connection
+}
+
+func newRPCServer(t *testing.T) *rpcServer {
+	s := &rpcServer{}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		s.serve(conn)
+	}))
+	t.Cleanup(func() {
+		s.disconnect()
+		s.Close()
+	})
+	return s
+}
+
+func (s *rpcServer) serve(conn *websocket.Conn) {
+	for {
+		var req struct {
+			ID     *json.RawMessage `json:"id"`
+			Method string           `json:"method"`
+			Params json.RawMessage  `json:"params"`
+		}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.calls = append(s.calls, rpcCall{Method: req.Method, Params: req.Params, conn: conn})
+		handler := s.handler
+		s.mu.Unlock()
+
+		var result interface{} = true
+		var rpcErr *rpcError
+		if handler != nil {
+			result, rpcErr = handler(req.Method, req.Params)
+		}
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result}
+		if rpcErr != nil {
+			response = map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": rpcErr}
+		}
+		s.wmu.Lock()
+		conn.WriteJSON(response)
+		s.wmu.Unlock()
+	}
+}
+
+func (s *rpcServer) url() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// handle sets the handler answering the calls.
+func (s *rpcServer) handle(handler func(method string, params json.RawMessage) (interface{}, *rpcError)) {
+	s.mu.Lock()
+	s.handler = handler
+	s.mu.Unlock()
+}
+
+// notify sends a notification of method on the connection that received the
+// last call of callMethod.
+func (s *rpcServer) notify(method string, callMethod string, params interface{}) {
+	s.mu.Lock()
+	var conn *websocket.Conn
+	for _, c := range s.calls {
+		if c.Method == callMethod {
+			conn = c.conn
+		}
+	}
+	s.mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// count returns the number of calls of method received.
+func (s *rpcServer) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// lastParams returns the params of the last call of method.
+func (s *rpcServer) lastParams(method string) json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.calls) - 1; i >= 0; i-- {
+		if s.calls[i].Method == method {
+			return s.calls[i].Params
+		}
+	}
+	return nil
+}
+
+// disconnect closes every connection opened so far.
+func (s *rpcServer) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+// disconnectConn closes the i-th connection opened.
+func (s *rpcServer) disconnectConn(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[i].Close()
+}
+
+// eventually fails the test unless cond becomes true within 5 seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
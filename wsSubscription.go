@@ -0,0 +1,200 @@
+package spiral
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+)
+
+// Subscription is the handle of one consumer of a WebSocket feed.
+//
+// Every Subscribe call returns a new handle with its own channels and
+// buffering, so several consumers of the same feed each receive every
+// notification. The server subscription is opened with the first handle of a
+// feed and closed with the last one. A handle subscribed while others are
+// open receives the updates from there, the snapshot only comes with the next
+// one the server sends.
+type Subscription struct {
+	owner feedOwner
+	feed  *feed
+
+	closeOnce sync.Once
+	err       error
+}
+
+// ErrSubscriptionClosed is returned when using a closed subscription.
+var ErrSubscriptionClosed = errors.New("Spiral subscription closed")
+
+// feedOwner is the WSClient, WSPool or StreamClient a subscription belongs to.
+// It knows how its feeds are opened and closed on its connections.
+type feedOwner interface {
+	// release unregisters f, closing its feed on the server if it was the
+	// last handle of it.
+	release(f *feed) error
+	// resync opens the feed of f again, which makes the server send a new
+	// snapshot.
+	resync(f *feed) error
+}
+
+// feedRequest describes a feed and how to open and close it on the server.
+type feedRequest struct {
+	key         string
+	create      func(key string, opts FeedOptions) *feed
+	subscribe   func(c *WSClient) error
+	unsubscribe func(c *WSClient) error
+}
+
+// Key returns the feed and symbol of the subscription, ie. ticker:ETHBTC.
+func (s *Subscription) Key() string {
+	return s.feed.key
+}
+
+// Stats returns the buffering state of the subscription.
+func (s *Subscription) Stats() FeedStats {
+	return s.feed.stats()
+}
+
+// Dropped returns the number of notifications discarded or merged by the
+// overflow policy of the subscription, discarded by a full client inbox or
+// that could not be converted to the model of the subscription.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.feed.queue.dropped)
+}
+
+// Close closes the channels of the subscription. The server subscription is
+// closed as well when no other handle uses it.
+func (s *Subscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.err = s.owner.release(s.feed)
+	})
+	return s.err
+}
+
+// subscribe registers a new feed for req, opening it on the server if it is
+// the first one.
+func (c *WSClient) subscribe(req feedRequest, opts FeedOptions) (*Subscription, error) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	select {
+	case <-c.closed:
+		return nil, ErrWSClientClosed
+	default:
+	}
+
+	f, first, err := c.updates.feeds.add(req.key, opts, req.create)
+	if err != nil {
+		return nil, err
+	}
+	if first {
+		if err := req.subscribe(c); err != nil {
+			c.updates.feeds.remove(f)
+			return nil, err
+		}
+		c.requests[req.key] = req
+	}
+	return &Subscription{owner: c, feed: f}, nil
+}
+
+// release unregisters f, closing it on the server if it was the last feed of
+// its key. Feeds already closed by Close are ignored.
+func (c *WSClient) release(f *feed) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	found, last := c.updates.feeds.remove(f)
+	req, ok := c.requests[f.key]
+	if !found || !last || !ok {
+		return nil
+	}
+	delete(c.requests, f.key)
+	return req.unsubscribe(c)
+}
+
+// resync subscribes again to the feed of f, which makes the server send a
+// new snapshot to every handle of the feed.
+func (c *WSClient) resync(f *feed) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	req, ok := c.requests[f.key]
+	if !ok || !c.updates.feeds.contains(f) {
+		return ErrSubscriptionClosed
+	}
+	return req.subscribe(c)
+}
+
+// TickerSubscription is a subscription to the ticker of a market.
+type TickerSubscription struct {
+	*Subscription
+	Updates <-chan WSNotificationTickerResponse
+}
+
+// OrderbookSubscription is a subscription to the order book of a market.
+type OrderbookSubscription struct {
+	*Subscription
+	Updates   <-chan WSNotificationOrderbookUpdate
+	Snapshots <-chan WSNotificationOrderbookSnapshot
+}
+
+// Resync asks the server for a new snapshot of the order book, ie. after a
+// sequence gap. Every handle of the feed receives it.
+func (s *OrderbookSubscription) Resync() error {
+	return s.owner.resync(s.feed)
+}
+
+// TradesSubscription is a subscription to the trades of a market.
+type TradesSubscription struct {
+	*Subscription
+	Updates   <-chan WSNotificationTradesUpdate
+	Snapshots <-chan WSNotificationTradesSnapshot
+}
+
+// CandlesSubscription is a subscription to the candles of a market.
+type CandlesSubscription struct {
+	*Subscription
+	Updates   <-chan WSNotificationCandlesUpdate
+	Snapshots <-chan WSNotificationCandlesSnapshot
+}
+
+// ReportsSubscription is a subscription to the reports of your orders.
+type ReportsSubscription struct {
+	*Subscription
+	Updates   <-chan WSOrderReport
+	Snapshots <-chan []WSOrderReport // active orders
+}
+
+// BalancesSubscription is a subscription to the changes of your balances.
+type BalancesSubscription struct {
+	*Subscription
+	Updates <-chan []WSBalance
+}
+
+func newTickerSubscription(s *Subscription) *TickerSubscription {
+	return &TickerSubscription{Subscription: s, Updates: s.feed.updates.(<-chan WSNotificationTickerResponse)}
+}
+
+func newOrderbookSubscription(s *Subscription) *OrderbookSubscription {
+	return &OrderbookSubscription{
+		Subscription: s,
+		Updates:      s.feed.updates.(<-chan WSNotificationOrderbookUpdate),
+		Snapshots:    s.feed.snapshots.(<-chan WSNotificationOrderbookSnapshot),
+	}
+}
+
+func newTradesSubscription(s *Subscription) *TradesSubscription {
+	return &TradesSubscription{
+		Subscription: s,
+		Updates:      s.feed.updates.(<-chan WSNotificationTradesUpdate),
+		Snapshots:    s.feed.snapshots.(<-chan WSNotificationTradesSnapshot),
+	}
+}
+
+func newCandlesSubscription(s *Subscription) *CandlesSubscription {
+	return &CandlesSubscription{
+		Subscription: s,
+		Updates:      s.feed.updates.(<-chan WSNotificationCandlesUpdate),
+		Snapshots:    s.feed.snapshots.(<-chan WSNotificationCandlesSnapshot),
+	}
+}